@@ -0,0 +1,43 @@
+package idec
+
+// Message address field
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Address message origin: station name and point number
+type Address struct {
+	Station string `json:"station"`
+	Point   int    `json:"point"`
+}
+
+// ParseAddress parse address field such as "dynamic,1" or "station13, 13".
+// Returns error wrapping ErrBadAddress.
+func ParseAddress(address string) (Address, error) {
+	i := strings.LastIndex(address, ",")
+	if i < 0 {
+		return Address{}, fmt.Errorf("%w %q: no point number", ErrBadAddress, address)
+	}
+	station := strings.TrimSpace(address[:i])
+	if station == "" {
+		return Address{}, fmt.Errorf("%w %q: empty station", ErrBadAddress, address)
+	}
+	point, err := strconv.Atoi(strings.TrimSpace(address[i+1:]))
+	if err != nil || point < 0 {
+		return Address{}, fmt.Errorf("%w %q: bad point number", ErrBadAddress, address)
+	}
+	return Address{station, point}, nil
+}
+
+// String makes canonical address field station,point
+func (a Address) String() string {
+	return a.Station + "," + strconv.Itoa(a.Point)
+}
+
+// StationAddress parse message Address field
+func (m Message) StationAddress() (Address, error) {
+	return ParseAddress(m.Address)
+}
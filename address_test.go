@@ -0,0 +1,48 @@
+package idec
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    Address
+	}{
+		{"dynamic,1", Address{"dynamic", 1}},
+		{"station13, 13", Address{"station13", 13}},
+		{" station13 ,13 ", Address{"station13", 13}},
+		{"some,station,7", Address{"some,station", 7}},
+	}
+	for _, test := range tests {
+		a, err := ParseAddress(test.address)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if a != test.want {
+			t.Errorf("%q parsed as %+v", test.address, a)
+		}
+	}
+	if a := (Address{"station13", 13}); a.String() != "station13,13" {
+		t.Errorf("Wrong address formatting: %s", a)
+	}
+
+	for _, address := range []string{"", "dynamic", ",1", "dynamic,", "dynamic,one", "dynamic,-1"} {
+		if _, err := ParseAddress(address); !errors.Is(err, ErrBadAddress) {
+			t.Errorf("Bad address %q parsed", address)
+		}
+	}
+}
+
+func TestMessageStationAddress(t *testing.T) {
+	m, err := ParseMessage(testBundle("ii.test.14", "Test message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := m.StationAddress()
+	if err != nil || a.Station != "dynamic" || a.Point != 1 {
+		t.Errorf("Wrong station address: %+v, %v", a, err)
+	}
+}
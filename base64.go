@@ -0,0 +1,98 @@
+package idec
+
+// Tolerant base64 of node implementations in the wild
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Base64Variant base64 flavour flags, zero is padded standard one
+type Base64Variant uint8
+
+// Base64 variants
+const (
+	// Base64URL URL-safe alphabet with '-' and '_'
+	Base64URL Base64Variant = 1 << iota
+	// Base64Unpadded no trailing '='
+	Base64Unpadded
+	// Base64Wrapped lines of Base64LineLength
+	Base64Wrapped
+)
+
+// Base64LineLength wrapped base64 line length
+const Base64LineLength = 76
+
+func (v Base64Variant) String() string {
+	var s []string
+	if v&Base64URL != 0 {
+		s = append(s, "url")
+	} else {
+		s = append(s, "std")
+	}
+	if v&Base64Unpadded != 0 {
+		s = append(s, "unpadded")
+	}
+	if v&Base64Wrapped != 0 {
+		s = append(s, "wrapped")
+	}
+	return strings.Join(s, ",")
+}
+
+// encoding returns variant encoding
+func (v Base64Variant) encoding() *base64.Encoding {
+	enc := base64.StdEncoding
+	if v&Base64URL != 0 {
+		enc = base64.URLEncoding
+	}
+	if v&Base64Unpadded != 0 {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+	return enc
+}
+
+// DecodeBase64 decodes wrapped, URL-safe and unpadded base64
+// and reports the variant seen. Mixed alphabets are rejected.
+// Returns error wrapping ErrBadBase64.
+func DecodeBase64(s string) ([]byte, Base64Variant, error) {
+	var v Base64Variant
+	if strings.ContainsAny(s, "\r\n") {
+		v |= Base64Wrapped
+		s = strings.NewReplacer("\r", "", "\n", "").Replace(s)
+	}
+
+	std := strings.ContainsAny(s, "+/")
+	if strings.ContainsAny(s, "-_") {
+		if std {
+			return nil, v, fmt.Errorf("%w: mixed std and url alphabets", ErrBadBase64)
+		}
+		v |= Base64URL
+	}
+	if len(s)%4 != 0 && !strings.HasSuffix(s, "=") {
+		v |= Base64Unpadded
+	}
+
+	b, err := v.encoding().DecodeString(s)
+	if err != nil {
+		return nil, v, fmt.Errorf("%w: %v", ErrBadBase64, err)
+	}
+	return b, v, nil
+}
+
+// EncodeBase64 encodes b in variant a peer expects
+func EncodeBase64(b []byte, v Base64Variant) string {
+	s := v.encoding().EncodeToString(b)
+	if v&Base64Wrapped == 0 {
+		return s
+	}
+
+	var wrapped strings.Builder
+	for len(s) > Base64LineLength {
+		wrapped.WriteString(s[:Base64LineLength])
+		wrapped.WriteByte('\n')
+		s = s[Base64LineLength:]
+	}
+	wrapped.WriteString(s)
+	return wrapped.String()
+}
@@ -0,0 +1,93 @@
+package idec
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// variantRaw encodes with '+', '/' and padding
+const variantRaw = testRaw + "Тест ??? >>>"
+
+func TestDecodeBase64(t *testing.T) {
+	plain := []byte(variantRaw)
+	variants := []Base64Variant{
+		0,
+		Base64URL,
+		Base64Unpadded,
+		Base64Wrapped,
+		Base64URL | Base64Unpadded | Base64Wrapped,
+	}
+	for _, v := range variants {
+		encoded := EncodeBase64(plain, v)
+		decoded, seen, err := DecodeBase64(encoded)
+		if err != nil {
+			t.Errorf("%s: %v", v, err)
+			continue
+		}
+		if !bytes.Equal(decoded, plain) {
+			t.Errorf("%s: wrong decoding", v)
+		}
+		if seen != v {
+			t.Errorf("Wrong variant: %s, want %s", seen, v)
+		}
+	}
+
+	for _, line := range strings.Split(EncodeBase64(plain, Base64Wrapped), "\n") {
+		if len(line) > Base64LineLength {
+			t.Errorf("Wrong line length: %d", len(line))
+		}
+	}
+
+	if _, _, err := DecodeBase64("ab+c-d=="); !errors.Is(err, ErrBadBase64) {
+		t.Errorf("Mixed alphabets decoded: %v", err)
+	}
+	if _, _, err := DecodeBase64("Bla*Bla"); !errors.Is(err, ErrBadBase64) {
+		t.Errorf("Bad base64 decoded: %v", err)
+	}
+}
+
+func TestParseMessageVariants(t *testing.T) {
+	want, err := ParseMessage(EncodeBase64([]byte(variantRaw), 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []Base64Variant{Base64URL, Base64Unpadded | Base64Wrapped} {
+		m, err := ParseMessage(EncodeBase64([]byte(variantRaw), v))
+		if err != nil {
+			t.Errorf("%s: %v", v, err)
+			continue
+		}
+		if m.Variant != v || m.Body != want.Body {
+			t.Errorf("%s: wrong message %+v", v, m)
+		}
+		if m, err := ParseMessageBytes([]byte(EncodeBase64([]byte(variantRaw), v))); err != nil || m.Variant != v {
+			t.Errorf("%s: wrong bytes parsing %v", v, err)
+		}
+
+		// Rendered back in the same variant
+		bundle, err := m.BundleVariant(m.Variant)
+		if err != nil || bundle != EncodeBase64([]byte(variantRaw), v) {
+			t.Errorf("%s: wrong bundle %v", v, err)
+		}
+		msg := MSG{EncodeBase64([]byte(variantRaw), v), MakeMsgID(variantRaw)}
+		if err := VerifyMSG(msg); err != nil {
+			t.Errorf("%s: %v", v, err)
+		}
+	}
+
+	p := &PointMessage{Echo: "ii.test.14", To: "All", Subg: "test", Repto: "@repto:hXzRNEzmMuzKkT1HCxUb", Body: "Тест ??? >>>"}
+	for _, v := range []Base64Variant{0, Base64URL | Base64Unpadded} {
+		message := p.PrepareMessageForSendVariant(v)
+		unescaped, _ := url.QueryUnescape(message)
+		if unescaped != EncodeBase64([]byte(p.Echo+"\n"+p.To+"\n"+p.Subg+"\n\n"+p.Repto+"\n"+p.Body), v) {
+			t.Errorf("%s: wrong point message %s", v, message)
+		}
+		parsed, err := ParsePointMessage(message)
+		if err != nil || parsed.Variant != v || parsed.Repto != "hXzRNEzmMuzKkT1HCxUb" || parsed.Body != "\n"+p.Body {
+			t.Errorf("%s: wrong point parsing %+v %v", v, parsed, err)
+		}
+	}
+}
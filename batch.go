@@ -0,0 +1,162 @@
+package idec
+
+// Chunked concurrent u/m download
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// BatchFetcher defaults
+const (
+	DefaultChunkSize = 40
+	DefaultWorkers   = 4
+)
+
+// BatchFetcher splits u/m requests into chunks
+// and downloads them concurrently
+type BatchFetcher struct {
+	Client *Client
+	// ChunkSize message ids per u/m request
+	ChunkSize int
+	// Workers concurrent requests
+	Workers int
+}
+
+// NewBatchFetcher makes BatchFetcher with default chunk size and workers
+func NewBatchFetcher(c *Client) *BatchFetcher {
+	return &BatchFetcher{
+		Client:    c,
+		ChunkSize: DefaultChunkSize,
+		Workers:   DefaultWorkers,
+	}
+}
+
+// ChunkError failed chunk download with ids not fetched.
+// IDs is empty if all chunk messages were fetched anyway.
+type ChunkError struct {
+	IDs []ID
+	Err error
+}
+
+func (e *ChunkError) Error() string {
+	if len(e.IDs) == 0 {
+		return "chunk: " + e.Err.Error()
+	}
+	return fmt.Sprintf("chunk of %d messages starting at %s: %s", len(e.IDs), e.IDs[0].MsgID, e.Err)
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError failed chunks of batch download
+type BatchError struct {
+	Chunks []*ChunkError
+}
+
+func (e *BatchError) Error() string {
+	var s []string
+	for _, c := range e.Chunks {
+		s = append(s, c.Error())
+	}
+	return fmt.Sprintf("%d chunks failed: %s", len(e.Chunks), strings.Join(s, "; "))
+}
+
+func (e *BatchError) Unwrap() []error {
+	var errs []error
+	for _, c := range e.Chunks {
+		errs = append(errs, c)
+	}
+	return errs
+}
+
+// FailedIDs returns ids not fetched
+func (e *BatchError) FailedIDs() []ID {
+	var ids []ID
+	for _, c := range e.Chunks {
+		ids = append(ids, c.IDs...)
+	}
+	return ids
+}
+
+// GetRawMessages get messages from node in chunks.
+// Messages are returned in ids order. If some chunks fail
+// or miss messages, fetched ones are returned with *BatchError.
+func (b *BatchFetcher) GetRawMessages(ctx context.Context, ids []ID) ([]MSG, error) {
+	size := b.ChunkSize
+	if size <= 0 {
+		size = DefaultChunkSize
+	}
+	workers := b.Workers
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+
+	var chunks [][]ID
+	for i := 0; i < len(ids); i += size {
+		end := i + size
+		if end > len(ids) {
+			end = len(ids)
+		}
+		chunks = append(chunks, ids[i:end])
+	}
+
+	results := make([][]MSG, len(chunks))
+	errs := make([]error, len(chunks))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(chunks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+					continue
+				}
+				results[i], errs[i] = b.Client.GetRawMessages(ctx, chunks[i])
+			}
+		}()
+	}
+	for i := range chunks {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var messages []MSG
+	var failed []*ChunkError
+	for i, chunk := range chunks {
+		// Node may return messages in any order
+		byID := make(map[string]MSG, len(results[i]))
+		for _, m := range results[i] {
+			byID[m.ID] = m
+		}
+
+		var lost []ID
+		for _, id := range chunk {
+			if m, ok := byID[id.MsgID]; ok {
+				messages = append(messages, m)
+			} else if !b.Client.Blacklist.Contains(id.MsgID) {
+				lost = append(lost, id)
+			}
+		}
+		// Node may silently leave messages out
+		err := errs[i]
+		if err == nil && lost != nil {
+			err = fmt.Errorf("%w: %d of %d messages", ErrMissing, len(lost), len(chunk))
+		}
+		if err != nil {
+			failed = append(failed, &ChunkError{lost, err})
+		}
+	}
+
+	if failed != nil {
+		return messages, &BatchError{failed}
+	}
+	return messages, nil
+}
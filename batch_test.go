@@ -0,0 +1,117 @@
+package idec
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestBatchFetcher(t *testing.T) {
+	c, mock := newMockClient()
+	ids := []ID{
+		{"ii.test.14", "hXzRNEzmMuzKkT1HCxUb"},
+		{"ii.test.14", "JN3ylpxjaNofxgPy6NhL"},
+		{"ii.test.14", "xF3kkmrZYld330BO7qaA"},
+		{"ii.test.14", "3uS3uij0Y4AUnSxhf4WB"},
+		{"ii.test.14", "zi9YpQGddLW5WQKi9GMf"},
+	}
+	// Echo requested ids back in reverse order
+	mock.RegisterNoResponder(func(req *http.Request) (*http.Response, error) {
+		requested := strings.Split(strings.TrimPrefix(req.URL.Path, "/idec/u/m/"), "/")
+		var lines []string
+		for i := len(requested) - 1; i >= 0; i-- {
+			if requested[i] == "3uS3uij0Y4AUnSxhf4WB" {
+				return httpmock.NewStringResponse(502, "Bad Gateway"), nil
+			}
+			lines = append(lines, requested[i]+":YQ==")
+		}
+		return httpmock.NewStringResponse(200, strings.Join(lines, "\n")), nil
+	})
+
+	b := NewBatchFetcher(c)
+	b.ChunkSize = 2
+	b.Workers = 2
+	msgs, err := b.GetRawMessages(context.Background(), ids)
+
+	var berr *BatchError
+	if !errors.As(err, &berr) {
+		t.Fatalf("Wrong error: %v", err)
+	}
+	failed := berr.FailedIDs()
+	if len(failed) != 2 || failed[0] != ids[2] || failed[1] != ids[3] {
+		t.Errorf("Wrong failed ids: %v", failed)
+	}
+
+	if len(msgs) != 3 {
+		t.Fatalf("Wrong messages: %v", msgs)
+	}
+	for i, id := range []ID{ids[0], ids[1], ids[4]} {
+		if msgs[i].ID != id.MsgID {
+			t.Errorf("Wrong order: %v", msgs)
+		}
+	}
+	if n := mock.GetTotalCallCount(); n != 3 {
+		t.Errorf("Wrong requests count: %d", n)
+	}
+}
+
+func TestBatchFetcherMissing(t *testing.T) {
+	c, mock := newMockClient()
+	ids := []ID{
+		{"ii.test.14", "hXzRNEzmMuzKkT1HCxUb"},
+		{"ii.test.14", "JN3ylpxjaNofxgPy6NhL"},
+		{"ii.test.14", "xF3kkmrZYld330BO7qaA"},
+	}
+	// Node leaves out the first message
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/hXzRNEzmMuzKkT1HCxUb/JN3ylpxjaNofxgPy6NhL", httpmock.NewStringResponder(200, "JN3ylpxjaNofxgPy6NhL:YQ==\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/xF3kkmrZYld330BO7qaA", httpmock.NewStringResponder(200, "xF3kkmrZYld330BO7qaA:YQ==\n"))
+
+	b := NewBatchFetcher(c)
+	b.ChunkSize = 2
+	msgs, err := b.GetRawMessages(context.Background(), ids)
+	var berr *BatchError
+	if !errors.As(err, &berr) || !errors.Is(err, ErrMissing) {
+		t.Fatalf("Missing message not reported: %v", err)
+	}
+	if failed := berr.FailedIDs(); len(failed) != 1 || failed[0] != ids[0] {
+		t.Errorf("Wrong failed ids: %v", failed)
+	}
+	if len(msgs) != 2 {
+		t.Errorf("Wrong messages: %v", msgs)
+	}
+
+	// Blacklisted ids are not requested nor missing
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/JN3ylpxjaNofxgPy6NhL", httpmock.NewStringResponder(200, "JN3ylpxjaNofxgPy6NhL:YQ==\n"))
+	c.Blacklist = Blacklist{"hXzRNEzmMuzKkT1HCxUb": {}}
+	if msgs, err := b.GetRawMessages(context.Background(), ids); err != nil || len(msgs) != 2 {
+		t.Errorf("Wrong blacklisted fetch: %v %v", msgs, err)
+	}
+}
+
+// Chunk errors are reported even if all chunk messages are fetched
+func TestBatchFetcherChunkError(t *testing.T) {
+	c, mock := newMockClient()
+	c.Verify = VerifyReject
+	bundle := testBundle("ii.test.14", "test")
+	plain, _, _ := DecodeBase64(bundle)
+	id := ID{"ii.test.14", MakeMsgID(string(plain))}
+	// Node adds a forged message to the requested one
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/"+id.MsgID, httpmock.NewStringResponder(200,
+		id.MsgID+":"+bundle+"\nhXzRNEzmMuzKkT1HCxUb:"+bundle+"\n"))
+
+	msgs, err := NewBatchFetcher(c).GetRawMessages(context.Background(), []ID{id})
+	var berr *BatchError
+	if !errors.As(err, &berr) || !errors.Is(err, ErrIDMismatch) {
+		t.Fatalf("Chunk error is not reported: %v", err)
+	}
+	if failed := berr.FailedIDs(); len(failed) != 0 {
+		t.Errorf("Wrong failed ids: %v", failed)
+	}
+	if len(msgs) != 1 || msgs[0].ID != id.MsgID {
+		t.Errorf("Wrong messages: %v", msgs)
+	}
+}
@@ -0,0 +1,106 @@
+package idec
+
+// Bulk u/m bundle parsing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// BundleParser parses whole u/m responses, e.g. full echo imports.
+// Decode buffers are reused between Parse calls.
+type BundleParser struct {
+	buf   []byte
+	spans []bundleSpan
+}
+
+// bundleSpan message id and plain text offsets in buf
+type bundleSpan struct {
+	id, plain, end int
+	variant        Base64Variant
+	err            error
+}
+
+// ParseBundle parses u/m response, see BundleParser.Parse
+func ParseBundle(bundle []byte, msgs []Message) ([]Message, error) {
+	var p BundleParser
+	return p.Parse(bundle, msgs)
+}
+
+// Parse u/m response id:base64 lines into msgs reusing its storage.
+// Each message text is copied out of the reused decode buffer,
+// so kept messages don't keep the whole bundle in memory.
+// Bad messages are skipped and reported in error after the rest are parsed.
+func (p *BundleParser) Parse(bundle []byte, msgs []Message) ([]Message, error) {
+	p.buf = p.buf[:0]
+	p.spans = p.spans[:0]
+
+	for len(bundle) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(bundle, '\n'); i >= 0 {
+			line, bundle = bundle[:i], bundle[i+1:]
+		} else {
+			line, bundle = bundle, nil
+		}
+		line = bytes.TrimRight(line, "\r")
+		// Empty line ends bundle
+		if len(line) == 0 {
+			break
+		}
+
+		i := bytes.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		id, message := line[:i], line[i+1:]
+		if j := bytes.IndexByte(message, ':'); j >= 0 {
+			message = message[:j]
+		}
+		p.decode(id, message)
+	}
+
+	msgs = msgs[:0]
+	var errs []error
+	for _, s := range p.spans {
+		id := string(p.buf[s.id:s.plain])
+		err := s.err
+		if err == nil {
+			var m Message
+			m, err = parseMessage(p.buf[s.plain:s.end])
+			if err == nil {
+				m.ID = id
+				m.Variant = s.variant
+				msgs = append(msgs, m)
+				continue
+			}
+		}
+		errs = append(errs, fmt.Errorf("message %s: %w", id, err))
+	}
+	return msgs, errors.Join(errs...)
+}
+
+// decode appends message id and plain text to buf
+func (p *BundleParser) decode(id, message []byte) {
+	s := bundleSpan{id: len(p.buf)}
+	p.buf = append(p.buf, id...)
+	s.plain = len(p.buf)
+
+	n := base64.StdEncoding.DecodedLen(len(message))
+	if cap(p.buf)-len(p.buf) < n {
+		buf := make([]byte, len(p.buf), 2*cap(p.buf)+n)
+		copy(buf, p.buf)
+		p.buf = buf
+	}
+	n, err := base64.StdEncoding.Decode(p.buf[s.plain:s.plain+n], message)
+	p.buf = p.buf[:s.plain+n]
+	if err != nil {
+		// Other variants
+		var plain []byte
+		plain, s.variant, s.err = DecodeBase64(string(message))
+		p.buf = append(p.buf[:s.plain], plain...)
+	}
+	s.end = len(p.buf)
+	p.spans = append(p.spans, s)
+}
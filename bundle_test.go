@@ -0,0 +1,66 @@
+package idec
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBundle(t *testing.T) {
+	good := base64.StdEncoding.EncodeToString([]byte(testRaw))
+	bundle := "Jc0StQZltt2EoHV9fLee:" + good + "\r\n" +
+		"skipped line\n" +
+		"hXzRNEzmMuzKkT1HCxUb:Bla*Bla\n" +
+		"AAAAAAAAAAAAAAAAAAAA:" + good + "\n" +
+		"\n" +
+		"BBBBBBBBBBBBBBBBBBBB:" + good + "\n"
+
+	want, err := ParseMessage(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.ID = "Jc0StQZltt2EoHV9fLee"
+
+	var p BundleParser
+	msgs, err := p.Parse([]byte(bundle), nil)
+	if !errors.Is(err, ErrBadBase64) || !strings.Contains(err.Error(), "hXzRNEzmMuzKkT1HCxUb") {
+		t.Errorf("Wrong bundle error: %v", err)
+	}
+	if len(msgs) != 2 || msgs[1].ID != "AAAAAAAAAAAAAAAAAAAA" {
+		t.Fatalf("Wrong bundle messages: %v", msgs)
+	}
+	if !reflect.DeepEqual(msgs[0], want) {
+		t.Errorf("Wrong bundle message: %+v, want %+v", msgs[0], want)
+	}
+
+	// Storage is reused
+	reused, err := p.Parse([]byte("Jc0StQZltt2EoHV9fLee:"+good), msgs)
+	if err != nil || len(reused) != 1 || &reused[0] != &msgs[0] {
+		t.Errorf("Messages are not reused: %v", err)
+	}
+	if !reflect.DeepEqual(reused[0], want) {
+		t.Errorf("Wrong reused message: %+v", reused[0])
+	}
+
+	if _, err := ParseBundle([]byte("Jc0StQZltt2EoHV9fLee:"+base64.StdEncoding.EncodeToString([]byte("ii/ok"))), nil); !errors.Is(err, ErrTooFewLines) {
+		t.Errorf("Wrong bad message error: %v", err)
+	}
+}
+
+func BenchmarkParseBundle(b *testing.B) {
+	line := "Jc0StQZltt2EoHV9fLee:" + base64.StdEncoding.EncodeToString([]byte(testRaw)) + "\n"
+	bundle := []byte(strings.Repeat(line, 1000))
+	var p BundleParser
+	var msgs []Message
+	b.SetBytes(int64(len(bundle)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var err error
+		msgs, err = p.Parse(bundle, msgs)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
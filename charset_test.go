@@ -0,0 +1,84 @@
+package idec
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestCharsets(t *testing.T) {
+	tests := []struct {
+		charset Charset
+		encoded []byte
+	}{
+		{CharsetCP1251, []byte{0xCF, 0xF0, 0xE8, 0xE2, 0xE5, 0xF2, ',', ' ', 0xEC, 0xE8, 0xF0}},
+		{CharsetKOI8R, []byte{0xF0, 0xD2, 0xC9, 0xD7, 0xC5, 0xD4, ',', ' ', 0xCD, 0xC9, 0xD2}},
+	}
+	for _, test := range tests {
+		if s := DecodeCharset(test.encoded, test.charset); s != "Привет, мир" {
+			t.Errorf("%s: wrong decoding %q", test.charset, s)
+		}
+		b, err := EncodeCharset("Привет, мир", test.charset)
+		if err != nil || !bytes.Equal(b, test.encoded) {
+			t.Errorf("%s: wrong encoding %v %v", test.charset, b, err)
+		}
+		if c := DetectCharset(test.encoded); c != test.charset {
+			t.Errorf("Wrong charset detected: %q, want %s", c, test.charset)
+		}
+	}
+
+	sentences := []string{
+		"Съешь же ещё этих мягких французских булок",
+		"Съешь же ещё этих мягких французских булок, да выпей чаю.",
+		"ОК",
+		"Да",
+		"ВНИМАНИЕ: узел переезжает на новый адрес",
+		"Re: Несетевые проекты\n\nКто-нибудь помнит эху ii.test.14?",
+	}
+	for _, s := range sentences {
+		for _, charset := range Charsets {
+			b, err := EncodeCharset(s, charset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c := DetectCharset(b); c != charset {
+				t.Errorf("%s %q detected as %s", charset, s, c)
+			}
+		}
+	}
+
+	if c := DetectCharset([]byte("Привет, мир")); c != "" {
+		t.Errorf("UTF-8 detected as %s", c)
+	}
+	if _, err := EncodeCharset("Привет 🙂", CharsetKOI8R); err == nil {
+		t.Error("Missing character encoded")
+	}
+	if _, err := EncodeCharset("test", "latin1"); err == nil {
+		t.Error("Unknown charset encoded")
+	}
+}
+
+func TestParseMessageCharset(t *testing.T) {
+	utf := strings.Replace(testRaw, "Difrex\nRe: idec", "Вася\nRe: старые архивы", 1)
+	for _, charset := range Charsets {
+		raw, err := EncodeCharset(utf, charset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := ParseMessage(base64.StdEncoding.EncodeToString(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Charset != charset || m.To != "Вася" || m.Subg != "Re: старые архивы" ||
+			!strings.HasPrefix(m.Body, "\nИли даже так:") {
+			t.Errorf("%s: wrong transcoding %+v", charset, m)
+		}
+
+		// Message id is made from the original bytes
+		rendered, err := m.Raw()
+		if err != nil || rendered != string(raw) {
+			t.Errorf("%s: wrong rendering %v", charset, err)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package idec
+
+// Context-aware IDEC node client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client defaults
+const (
+	DefaultTimeout   = 30 * time.Second
+	DefaultUserAgent = "go-idec"
+)
+
+// Client IDEC node client.
+// All calls take a context and go through the supplied *http.Client,
+// so they can be cancelled and pointed at any transport.
+type Client struct {
+	// Node base URL, e.g. http://idec.example/
+	Node string
+	// HTTPClient used for all requests. http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// UserAgent sent with every request
+	UserAgent string
+	// Timeout applied to calls whose context has no deadline.
+	// Zero disables it.
+	Timeout time.Duration
+	// Blacklist message ids skipped by fetch calls
+	Blacklist Blacklist
+	// StrictIndex fails on malformed u/e responses, see IndexDecoder
+	StrictIndex bool
+	// Retry policy shared by all GET calls. No retries if nil.
+	Retry *RetryPolicy
+	// Verify policy for fetched message ids
+	Verify VerifyPolicy
+	// Dates check for fetched messages. No check if nil.
+	Dates *DateCheck
+	// Warn receives VerifyWarn mismatches. Ignored if nil.
+	Warn func(error)
+
+	mu       sync.Mutex
+	features *Features
+	// shared x/features cache by node, see FetchConfig.Client
+	shared *sync.Map
+}
+
+// NewClient makes Client for the node with default timeout and User-Agent.
+// httpClient may be nil.
+func NewClient(node string, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{
+		Node:       node,
+		HTTPClient: httpClient,
+		UserAgent:  DefaultUserAgent,
+		Timeout:    DefaultTimeout,
+	}
+}
+
+// url joins node address and request path
+func (c *Client) url(path ...string) string {
+	return strings.TrimRight(c.Node, "/") + "/" + strings.Join(path, "")
+}
+
+// cancelBody releases request context when response body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// do sends request with retries and returns response
+// with the body to be closed by caller.
+// Only GET requests are retried: resent u/point POST
+// would make node store the message twice.
+func (c *Client) do(ctx context.Context, method, uri, contentType string, body string) (*http.Response, error) {
+	cancel := context.CancelFunc(func() {})
+	if _, ok := ctx.Deadline(); !ok && c.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+	}
+
+	attempts := 1
+	if method == http.MethodGet {
+		attempts = c.Retry.attempts()
+	}
+	for n := 1; ; n++ {
+		resp, err := c.send(ctx, method, uri, contentType, body)
+		last := n == attempts || ctx.Err() != nil
+
+		if err != nil {
+			if last {
+				cancel()
+				if n > 1 {
+					err = fmt.Errorf("after %d attempts: %w", n, err)
+				}
+				return nil, err
+			}
+			if err := sleep(ctx, c.Retry.backoff(n)); err != nil {
+				cancel()
+				return nil, err
+			}
+			continue
+		}
+
+		if last || !c.Retry.retryable(resp.StatusCode) {
+			resp.Body = cancelBody{resp.Body, cancel}
+			return resp, nil
+		}
+
+		delay, ok := retryAfter(resp, time.Now())
+		if ok {
+			delay = c.Retry.cap(delay)
+		} else {
+			delay = c.Retry.backoff(n)
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+		if err := sleep(ctx, delay); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+}
+
+// send makes single request attempt
+func (c *Client) send(ctx context.Context, method, uri, contentType string, body string) (*http.Response, error) {
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req, err := http.NewRequest(method, uri, r)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return hc.Do(req)
+}
+
+// get makes GET request and checks response status
+func (c *Client) get(ctx context.Context, uri string) (*http.Response, error) {
+	resp, err := c.do(ctx, http.MethodGet, uri, "", "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxNodeErrorBody))
+		return nil, &NodeError{uri, resp.StatusCode, string(body)}
+	}
+	return resp, nil
+}
+
+// getBody makes GET request and reads whole response body
+func (c *Client) getBody(ctx context.Context, uri string) (string, error) {
+	resp, err := c.get(ctx, uri)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// eachID streams u/e index of echoes.
+// slice is offset:limit or empty for full index.
+func (c *Client) eachID(ctx context.Context, echoes []string, slice string, fn func(ID) error) error {
+	getURI := c.url(echoSchema, strings.Join(echoes, "/"))
+	if slice != "" {
+		getURI = strings.Join([]string{getURI, slice}, "/")
+	}
+
+	resp, err := c.get(ctx, getURI)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	d := NewIndexDecoder(resp.Body)
+	d.Strict = c.StrictIndex
+	for {
+		id, err := d.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(id); err != nil {
+			return err
+		}
+	}
+}
+
+// echoIndex get unfiltered u/e index of echoes
+func (c *Client) echoIndex(ctx context.Context, echoes []string, slice string) ([]ID, error) {
+	var ids []ID
+	err := c.eachID(ctx, echoes, slice, func(id ID) error {
+		ids = append(ids, id)
+		return nil
+	})
+	return ids, err
+}
+
+// EachMessageID calls fn for every message id of echoes
+// as it is read from the node. Blacklisted ids are skipped.
+func (c *Client) EachMessageID(ctx context.Context, echoes []string, fn func(ID) error) error {
+	return c.eachID(ctx, echoes, "", func(id ID) error {
+		if c.Blacklist.Contains(id.MsgID) {
+			return nil
+		}
+		return fn(id)
+	})
+}
+
+// GetMessagesIDS get message ids of echoes from node using offset:limit slice
+func (c *Client) GetMessagesIDS(ctx context.Context, echoes []string, offset, limit int) ([]ID, error) {
+	ids, err := c.echoIndex(ctx, echoes, sliceString(offset, limit))
+	if err != nil {
+		return nil, err
+	}
+	return c.Blacklist.Filter(ids), nil
+}
+
+// GetAllMessagesIDS get all message ids of echoes from node
+func (c *Client) GetAllMessagesIDS(ctx context.Context, echoes []string) ([]ID, error) {
+	ids, err := c.echoIndex(ctx, echoes, "")
+	if err != nil {
+		return nil, err
+	}
+	return c.Blacklist.Filter(ids), nil
+}
+
+// EachRawMessage calls fn for every message
+// as it is read from the node.
+// Messages rejected by Verify policy are skipped
+// and reported in error after the rest are read.
+func (c *Client) EachRawMessage(ctx context.Context, ids []ID, fn func(MSG) error) error {
+	var messagesIDS []string
+	for _, id := range c.Blacklist.Filter(ids) {
+		messagesIDS = append(messagesIDS, id.MsgID)
+	}
+	if len(messagesIDS) == 0 {
+		return nil
+	}
+
+	resp, err := c.get(ctx, c.url(messageSchema, strings.Join(messagesIDS, "/")))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var rejected []error
+	d := NewBundleDecoder(resp.Body)
+	for {
+		m, err := d.Next()
+		if err == io.EOF {
+			return errors.Join(rejected...)
+		}
+		if err != nil {
+			return err
+		}
+		if err := c.verify(m); err != nil {
+			rejected = append(rejected, err)
+			continue
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+}
+
+// verify applies Verify and Dates policies to message
+func (c *Client) verify(m MSG) error {
+	if c.Verify != VerifyAccept {
+		if err := c.apply(c.Verify, VerifyMSG(m)); err != nil {
+			return err
+		}
+	}
+	if c.Dates != nil && c.Dates.Policy != VerifyAccept {
+		return c.apply(c.Dates.Policy, c.Dates.checkMSG(m))
+	}
+	return nil
+}
+
+// apply policy to verification error
+func (c *Client) apply(policy VerifyPolicy, err error) error {
+	if err == nil || policy == VerifyReject {
+		return err
+	}
+
+	if c.Warn != nil {
+		c.Warn(err)
+	}
+	return nil
+}
+
+// GetRawMessages get messages from node.
+// Messages read before error are returned with it.
+func (c *Client) GetRawMessages(ctx context.Context, ids []ID) ([]MSG, error) {
+	var messages []MSG
+	err := c.EachRawMessage(ctx, ids, func(m MSG) error {
+		messages = append(messages, m)
+		return nil
+	})
+	return messages, err
+}
+
+// Features get node features from x/features.
+// Result is cached for the Client lifetime.
+func (c *Client) Features(ctx context.Context) (Features, error) {
+	c.mu.Lock()
+	cached := c.features
+	c.mu.Unlock()
+	if cached != nil {
+		return *cached, nil
+	}
+	if c.shared != nil {
+		if f, ok := c.shared.Load(nodeKey(c.Node)); ok {
+			return f.(Features), nil
+		}
+	}
+
+	body, err := c.getBody(ctx, c.url(features))
+	if err != nil {
+		return Features{}, err
+	}
+	f := ParseFeatures(body)
+
+	c.mu.Lock()
+	c.features = &f
+	c.mu.Unlock()
+	if c.shared != nil {
+		c.shared.Store(nodeKey(c.Node), f)
+	}
+	return f, nil
+}
+
+// supports checks that node announces feature
+func (c *Client) supports(ctx context.Context, feature string) (bool, error) {
+	f, err := c.Features(ctx)
+	if err != nil {
+		return false, err
+	}
+	return f.Supports(feature), nil
+}
+
+// GetEchoCounts get messages count of echoes from node x/c
+func (c *Client) GetEchoCounts(ctx context.Context, echoes []string) (map[string]int, error) {
+	ok, err := c.supports(ctx, FeatureXCount)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrNotSupported, FeatureXCount)
+	}
+
+	body, err := c.getBody(ctx, c.url(xcount, strings.Join(echoes, "/")))
+	if err != nil {
+		return nil, err
+	}
+	return ParseEchoCounts(body)
+}
+
+// GetBlacklist get blacklisted message ids from node blacklist.txt
+func (c *Client) GetBlacklist(ctx context.Context) (Blacklist, error) {
+	ok, err := c.supports(ctx, FeatureBlacklistTXT)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrNotSupported, FeatureBlacklistTXT)
+	}
+
+	body, err := c.getBody(ctx, c.url(blacklistTXT))
+	if err != nil {
+		return nil, err
+	}
+	return ParseBlacklist(body), nil
+}
+
+// GetEchoList get echoes list from node list.txt
+func (c *Client) GetEchoList(ctx context.Context) ([]Echo, error) {
+	// Check node features support
+	ok, err := c.supports(ctx, FeatureListTXT)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrNotSupported, FeatureListTXT)
+	}
+
+	l, err := c.getBody(ctx, c.url(listTXT))
+	if err != nil {
+		return nil, err
+	}
+	return ParseEchoList(l)
+}
+
+// PostMessage sends prepared base64 point message to the node
+func (c *Client) PostMessage(ctx context.Context, authstring, message string) error {
+	data := fmt.Sprintf("pauth=%s&tmsg=%s", authstring, message)
+	uri := c.url("u/point")
+	resp, err := c.do(ctx, http.MethodPost, uri, "application/x-www-form-urlencoded", data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(string(body), "msg ok") {
+		return &NodeError{uri, resp.StatusCode, string(body)}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package idec
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func newMockClient() (*Client, *httpmock.MockTransport) {
+	mock := httpmock.NewMockTransport()
+	c := NewClient("http://localhost/idec/", &http.Client{Transport: mock})
+	return c, mock
+}
+
+func TestNewClient(t *testing.T) {
+	c := NewClient("http://localhost/idec", nil)
+	if c.HTTPClient != http.DefaultClient {
+		t.Error("Default http client not set")
+	}
+	if c.Timeout != DefaultTimeout || c.UserAgent != DefaultUserAgent {
+		t.Error("Client defaults not set")
+	}
+	if c.url(echoSchema, "ii.test.14") != "http://localhost/idec/u/e/ii.test.14" {
+		t.Error("Wrong url: ", c.url(echoSchema, "ii.test.14"))
+	}
+}
+
+func TestClientUserAgent(t *testing.T) {
+	c, mock := newMockClient()
+	c.UserAgent = "test-agent"
+	mock.RegisterResponder("GET", "http://localhost/idec/u/e/ii.test.14", func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("User-Agent") != "test-agent" {
+			return httpmock.NewStringResponse(400, "bad agent"), nil
+		}
+		return httpmock.NewStringResponse(200, "ii.test.14\nhXzRNEzmMuzKkT1HCxUb\n"), nil
+	})
+
+	ids, err := c.GetAllMessagesIDS(context.Background(), []string{"ii.test.14"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0].Echo != "ii.test.14" || ids[0].MsgID != "hXzRNEzmMuzKkT1HCxUb" {
+		t.Errorf("Wrong ids: %v", ids)
+	}
+}
+
+func TestClientBadStatus(t *testing.T) {
+	c, mock := newMockClient()
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/hXzRNEzmMuzKkT1HCxUb", httpmock.NewStringResponder(502, "Bad Gateway"))
+
+	_, err := c.GetRawMessages(context.Background(), []ID{{"ii.test.14", "hXzRNEzmMuzKkT1HCxUb"}})
+	var nerr *NodeError
+	if !errors.As(err, &nerr) || nerr.StatusCode != 502 || nerr.URL != "http://localhost/idec/u/m/hXzRNEzmMuzKkT1HCxUb" || nerr.Body != "Bad Gateway" {
+		t.Errorf("Bad status not processed: %v", err)
+	}
+}
+
+func TestClientContext(t *testing.T) {
+	c, mock := newMockClient()
+	mock.RegisterResponder("GET", "http://localhost/idec/u/e/ii.test.14/-5:5", func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	})
+
+	// Cancelled by caller
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.GetMessagesIDS(ctx, []string{"ii.test.14"}, -5, 5); err == nil {
+		t.Error("Cancelled request succeeded")
+	}
+
+	// Cancelled by client timeout
+	c.Timeout = 10 * time.Millisecond
+	if _, err := c.GetMessagesIDS(context.Background(), []string{"ii.test.14"}, -5, 5); err == nil {
+		t.Error("Timed out request succeeded")
+	}
+}
+
+func TestClientPostMessage(t *testing.T) {
+	c, mock := newMockClient()
+	mock.RegisterResponder("POST", "http://localhost/idec/u/point", func(req *http.Request) (*http.Response, error) {
+		if err := req.ParseForm(); err != nil {
+			return nil, err
+		}
+		if req.PostForm.Get("pauth") != "auth" || req.PostForm.Get("tmsg") != "message" {
+			return httpmock.NewStringResponse(200, "error: bad form"), nil
+		}
+		return httpmock.NewStringResponse(200, "msg ok"), nil
+	})
+
+	if err := c.PostMessage(context.Background(), "auth", "message"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClientGetEchoCounts(t *testing.T) {
+	c, mock := newMockClient()
+	mock.RegisterResponder("GET", "http://localhost/idec/x/features", httpmock.NewStringResponder(200, "list.txt\nu/e\nx/c\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/x/c/ii.test.14/pipe.2032", httpmock.NewStringResponder(200, "ii.test.14:5\npipe.2032:1024\n"))
+
+	counts, err := c.GetEchoCounts(context.Background(), []string{"ii.test.14", "pipe.2032"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["ii.test.14"] != 5 || counts["pipe.2032"] != 1024 {
+		t.Errorf("Wrong counts: %v", counts)
+	}
+
+	// Not supported
+	c, mock = newMockClient()
+	mock.RegisterResponder("GET", "http://localhost/idec/x/features", httpmock.NewStringResponder(200, "list.txt\nu/e\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/x/c/ii.test.14", httpmock.NewStringResponder(200, "ii.test.14:5\n"))
+	if _, err := c.GetEchoCounts(context.Background(), []string{"ii.test.14"}); !errors.Is(err, ErrNotSupported) {
+		t.Error("x/c support not checked")
+	}
+}
+
+func TestClientBlacklist(t *testing.T) {
+	c, mock := newMockClient()
+	mock.RegisterResponder("GET", "http://localhost/idec/x/features", httpmock.NewStringResponder(200, "list.txt\nblacklist.txt\nu/e\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/blacklist.txt", httpmock.NewStringResponder(200, "JN3ylpxjaNofxgPy6NhL\nxF3kkmrZYld330BO7qaA\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/e/ii.test.14", httpmock.NewStringResponder(200, `ii.test.14
+hXzRNEzmMuzKkT1HCxUb
+JN3ylpxjaNofxgPy6NhL
+xF3kkmrZYld330BO7qaA
+3uS3uij0Y4AUnSxhf4WB`))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/hXzRNEzmMuzKkT1HCxUb/3uS3uij0Y4AUnSxhf4WB", httpmock.NewStringResponder(200, "hXzRNEzmMuzKkT1HCxUb:YQ==\n3uS3uij0Y4AUnSxhf4WB:Yg==\n"))
+
+	b, err := c.GetBlacklist(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(b) != 2 || !b.Contains("JN3ylpxjaNofxgPy6NhL") {
+		t.Errorf("Wrong blacklist: %v", b)
+	}
+
+	c.Blacklist = b
+	ids, err := c.GetAllMessagesIDS(context.Background(), []string{"ii.test.14"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("Blacklisted ids not skipped: %v", ids)
+	}
+
+	// Blacklisted ids must not be requested
+	ids = append(ids, ID{"ii.test.14", "xF3kkmrZYld330BO7qaA"})
+	msgs, err := c.GetRawMessages(context.Background(), ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 {
+		t.Errorf("Wrong messages: %v", msgs)
+	}
+}
+
+func TestClientFeatures(t *testing.T) {
+	c, mock := newMockClient()
+	mock.RegisterResponder("GET", "http://localhost/idec/x/features", httpmock.NewStringResponder(200, "list.txt\nu/e\nx/c\n"))
+
+	for i := 0; i < 2; i++ {
+		f, err := c.Features(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !f.Supports(FeatureListTXT) || f.Supports(FeatureBlacklistTXT) {
+			t.Errorf("Wrong features: %+v", f)
+		}
+	}
+	if n := mock.GetCallCountInfo()["GET http://localhost/idec/x/features"]; n != 1 {
+		t.Errorf("Features not cached, %d requests", n)
+	}
+}
+
+func TestClientStrictIndex(t *testing.T) {
+	c, mock := newMockClient()
+	mock.RegisterResponder("GET", "http://localhost/idec/u/e/ii.test.14", httpmock.NewStringResponder(200, "ii.test.14\nhXzRNEzmMuzKkT1HCxUb\n<html>\n"))
+
+	if _, err := c.GetAllMessagesIDS(context.Background(), []string{"ii.test.14"}); err != nil {
+		t.Error(err)
+	}
+	c.StrictIndex = true
+	if _, err := c.GetAllMessagesIDS(context.Background(), []string{"ii.test.14"}); !errors.Is(err, ErrBadResponse) {
+		t.Error("Bad index accepted")
+	}
+}
@@ -0,0 +1,73 @@
+package idec
+
+// Message dates
+
+import (
+	"fmt"
+	"time"
+)
+
+// IDECEpoch earliest plausible message date.
+// ii network, IDEC predecessor, started in 2014.
+var IDECEpoch = time.Date(2014, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// DefaultMaxFuture allowed clock skew of message authors
+const DefaultMaxFuture = 24 * time.Hour
+
+// Time returns message timestamp as time.Time
+func (m Message) Time() time.Time {
+	return time.Unix(int64(m.Timestamp), 0)
+}
+
+// SetTime sets message timestamp
+func (m *Message) SetTime(t time.Time) {
+	m.Timestamp = int(t.Unix())
+}
+
+// DateCheck flags messages dated in the future
+// or before IDEC existed, e.g. spam from 2099
+type DateCheck struct {
+	// NotBefore earliest allowed date, IDECEpoch if zero
+	NotBefore time.Time `json:"not_before"`
+	// MaxFuture allowed distance ahead of Clock, DefaultMaxFuture if zero
+	MaxFuture time.Duration `json:"max_future"`
+	// Policy for messages failing the check, VerifyAccept disables it
+	Policy VerifyPolicy `json:"policy"`
+	// Clock current time, time.Now if nil
+	Clock Clock `json:"-"`
+}
+
+// Check message date.
+// Returns *ValidationError with ErrTooOld or ErrFutureDate.
+func (d *DateCheck) Check(m Message) error {
+	notBefore := d.NotBefore
+	if notBefore.IsZero() {
+		notBefore = IDECEpoch
+	}
+	maxFuture := d.MaxFuture
+	if maxFuture == 0 {
+		maxFuture = DefaultMaxFuture
+	}
+
+	t := m.Time()
+	if t.Before(notBefore) {
+		return &ValidationError{"Timestamp", ErrTooOld}
+	}
+	if t.After(d.Clock.now().Add(maxFuture)) {
+		return &ValidationError{"Timestamp", ErrFutureDate}
+	}
+	return nil
+}
+
+// checkMSG checks fetched message date.
+// Unparsable messages are left to the caller.
+func (d *DateCheck) checkMSG(m MSG) error {
+	msg, err := ParseMessage(m.Message)
+	if err != nil {
+		return nil
+	}
+	if err := d.Check(msg); err != nil {
+		return fmt.Errorf("message %s dated %s: %w", m.ID, msg.Time().UTC().Format(time.RFC3339), err)
+	}
+	return nil
+}
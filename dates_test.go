@@ -0,0 +1,98 @@
+package idec
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestMessageTime(t *testing.T) {
+	var m Message
+	ts := time.Date(2019, time.March, 4, 8, 56, 6, 0, time.UTC)
+	m.SetTime(ts)
+	if m.Timestamp != 1551689766 || !m.Time().Equal(ts) {
+		t.Errorf("Wrong message time: %d %s", m.Timestamp, m.Time())
+	}
+}
+
+func TestMakeBundledMessageAt(t *testing.T) {
+	ts := time.Unix(1551689766, 0)
+	msg, err := MakeBundledMessageAt(&PointMessage{Echo: "ii.test.14", To: "All", Subg: "test", Body: "test"},
+		func() time.Time { return ts })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Timestamp != 1551689766 {
+		t.Errorf("Clock is not used: %d", msg.Timestamp)
+	}
+}
+
+func TestDateCheck(t *testing.T) {
+	now := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	d := &DateCheck{Clock: func() time.Time { return now }}
+	tests := []struct {
+		date time.Time
+		err  error
+	}{
+		{now, nil},
+		{IDECEpoch, nil},
+		{now.Add(DefaultMaxFuture), nil},
+		{IDECEpoch.Add(-time.Second), ErrTooOld},
+		{time.Unix(0, 0), ErrTooOld},
+		{now.Add(DefaultMaxFuture + time.Second), ErrFutureDate},
+		{time.Date(2099, time.January, 1, 0, 0, 0, 0, time.UTC), ErrFutureDate},
+	}
+	for _, test := range tests {
+		var m Message
+		m.SetTime(test.date)
+		err := d.Check(m)
+		if test.err == nil && err != nil || !errors.Is(err, test.err) {
+			t.Errorf("%s: %v, want %v", test.date, err, test.err)
+		}
+	}
+
+	d.NotBefore = now
+	d.MaxFuture = time.Hour
+	var m Message
+	m.SetTime(now.Add(-time.Second))
+	if err := d.Check(m); !errors.Is(err, ErrTooOld) {
+		t.Errorf("NotBefore is not used: %v", err)
+	}
+	m.SetTime(now.Add(2 * time.Hour))
+	if err := d.Check(m); !errors.Is(err, ErrFutureDate) {
+		t.Errorf("MaxFuture is not used: %v", err)
+	}
+}
+
+func TestClientDates(t *testing.T) {
+	c, mock := newMockClient()
+	spam := base64.StdEncoding.EncodeToString([]byte(strings.Replace(testRaw, "1551689766", "4070908800", 1)))
+	good := base64.StdEncoding.EncodeToString([]byte(testRaw))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/Jc0StQZltt2EoHV9fLee/hXzRNEzmMuzKkT1HCxUb", httpmock.NewStringResponder(200,
+		"Jc0StQZltt2EoHV9fLee:"+good+"\nhXzRNEzmMuzKkT1HCxUb:"+spam+"\n"))
+	ids := []ID{{"pipe.2032", "Jc0StQZltt2EoHV9fLee"}, {"pipe.2032", "hXzRNEzmMuzKkT1HCxUb"}}
+	now := func() time.Time { return time.Unix(1551689766, 0) }
+
+	// Warn
+	var warnings []error
+	c.Dates = &DateCheck{Policy: VerifyWarn, Clock: now}
+	c.Warn = func(err error) {
+		warnings = append(warnings, err)
+	}
+	msgs, err := c.GetRawMessages(context.Background(), ids)
+	if err != nil || len(msgs) != 2 || len(warnings) != 1 || !errors.Is(warnings[0], ErrFutureDate) {
+		t.Errorf("Wrong warn policy: %v, %v, %v", msgs, err, warnings)
+	}
+
+	// Reject
+	c.Dates.Policy = VerifyReject
+	msgs, err = c.GetRawMessages(context.Background(), ids)
+	if !errors.Is(err, ErrFutureDate) || len(msgs) != 1 || msgs[0].ID != "Jc0StQZltt2EoHV9fLee" {
+		t.Errorf("Wrong reject policy: %v, %v", msgs, err)
+	}
+}
@@ -0,0 +1,173 @@
+package idec
+
+// Streaming u/e and u/m decoders
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// lineReader reads lines without line ends
+type lineReader struct {
+	r   *bufio.Reader
+	err error
+	// n last read line number
+	n int
+}
+
+// readLine reads next line. Last line may be unterminated.
+// Underlying reader is not read after the first error.
+func (l *lineReader) readLine() (string, error) {
+	if l.err != nil {
+		return "", l.err
+	}
+	line, err := l.r.ReadString('\n')
+	if err != nil {
+		l.err = err
+		if err != io.EOF || line == "" {
+			return "", err
+		}
+	}
+	l.n++
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// IndexError bad line of u/e response
+type IndexError struct {
+	Line   int
+	Text   string
+	Reason string
+}
+
+func (e *IndexError) Error() string {
+	return fmt.Sprintf("u/e line %d %q: %s", e.Line, e.Text, e.Reason)
+}
+
+func (e *IndexError) Unwrap() error {
+	return ErrBadResponse
+}
+
+// IndexDecoder reads message ids from u/e response
+type IndexDecoder struct {
+	// Strict rejects bad echo names and message ids
+	// with *IndexError instead of skipping them
+	Strict bool
+
+	r    lineReader
+	echo string
+}
+
+// NewIndexDecoder makes IndexDecoder reading from r
+func NewIndexDecoder(r io.Reader) *IndexDecoder {
+	return &IndexDecoder{r: lineReader{r: bufio.NewReader(r)}}
+}
+
+// Next returns next message id. Returns io.EOF at the end of index.
+func (d *IndexDecoder) Next() (ID, error) {
+	for {
+		line, err := d.r.readLine()
+		if err != nil {
+			return ID{}, err
+		}
+		if d.Strict {
+			id, ok, err := d.strict(line)
+			if ok || err != nil {
+				return id, err
+			}
+			continue
+		}
+
+		// Match echoarea
+		if strings.Contains(line, ".") {
+			d.echo = line
+			continue
+		}
+
+		// Match message ID
+		if !strings.Contains(line, ":") && line != "" {
+			return ID{d.echo, line}, nil
+		}
+	}
+}
+
+// strict validates index line, ok is set for message id lines
+func (d *IndexDecoder) strict(line string) (ID, bool, error) {
+	switch {
+	case line == "":
+		return ID{}, false, nil
+	case isMsgID(line):
+		if d.echo == "" {
+			return ID{}, false, d.error(line, "message id before echo name")
+		}
+		return ID{d.echo, line}, true, nil
+	case isEchoName(line):
+		d.echo = line
+		return ID{}, false, nil
+	case len(line) == msgIDLength:
+		return ID{}, false, d.error(line, "bad message id")
+	}
+	return ID{}, false, d.error(line, "bad echo name")
+}
+
+func (d *IndexDecoder) error(line, reason string) error {
+	err := &IndexError{d.r.n, line, reason}
+	d.r.err = err
+	return err
+}
+
+// msgIDLength IDEC message id length
+const msgIDLength = 20
+
+// IsMsgID checks IDEC message id format: 20 latin letters and digits
+func IsMsgID(s string) bool {
+	return isMsgID(s)
+}
+
+// isMsgID checks message id format
+func isMsgID(s string) bool {
+	if len(s) != msgIDLength {
+		return false
+	}
+	for _, c := range s {
+		if !isAlnum(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(c rune) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// BundleDecoder reads messages from u/m response
+type BundleDecoder struct {
+	r lineReader
+}
+
+// NewBundleDecoder makes BundleDecoder reading from r
+func NewBundleDecoder(r io.Reader) *BundleDecoder {
+	return &BundleDecoder{lineReader{r: bufio.NewReader(r)}}
+}
+
+// Next returns next message. Returns io.EOF at the end of bundle.
+func (d *BundleDecoder) Next() (MSG, error) {
+	for {
+		line, err := d.r.readLine()
+		if err != nil {
+			return MSG{}, err
+		}
+		// Empty line ends bundle
+		if line == "" {
+			d.r.err = io.EOF
+			return MSG{}, io.EOF
+		}
+
+		message := strings.Split(line, ":")
+		if len(message) > 1 {
+			return MSG{message[1], message[0]}, nil
+		}
+	}
+}
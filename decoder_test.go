@@ -0,0 +1,98 @@
+package idec
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestIndexDecoder(t *testing.T) {
+	d := NewIndexDecoder(strings.NewReader("ii.test.14\r\nhXzRNEzmMuzKkT1HCxUb\r\n\npipe.2032\nJN3ylpxjaNofxgPy6NhL\nxF3kkmrZYld330BO7qaA"))
+
+	var ids []ID
+	for {
+		id, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) != 3 {
+		t.Fatalf("Wrong ids: %v", ids)
+	}
+	if ids[0] != (ID{"ii.test.14", "hXzRNEzmMuzKkT1HCxUb"}) || ids[2] != (ID{"pipe.2032", "xF3kkmrZYld330BO7qaA"}) {
+		t.Errorf("Wrong ids: %v", ids)
+	}
+	if _, err := d.Next(); err != io.EOF {
+		t.Error("EOF not repeated")
+	}
+}
+
+func TestBundleDecoder(t *testing.T) {
+	d := NewBundleDecoder(strings.NewReader("hXzRNEzmMuzKkT1HCxUb:YQ==\nbroken\nJN3ylpxjaNofxgPy6NhL:Yg==\n\nxF3kkmrZYld330BO7qaA:Yw==\n"))
+
+	m, err := d.Next()
+	if err != nil || m != (MSG{"YQ==", "hXzRNEzmMuzKkT1HCxUb"}) {
+		t.Errorf("Wrong message: %v, %v", m, err)
+	}
+	m, err = d.Next()
+	if err != nil || m.ID != "JN3ylpxjaNofxgPy6NhL" {
+		t.Errorf("Wrong message: %v, %v", m, err)
+	}
+	// Empty line ends bundle
+	if _, err = d.Next(); err != io.EOF {
+		t.Errorf("Wrong bundle end: %v", err)
+	}
+	if _, err = d.Next(); err != io.EOF {
+		t.Error("EOF not repeated")
+	}
+}
+
+func TestBundleDecoderLargeMessage(t *testing.T) {
+	body := strings.Repeat("YWJj", 1<<18)
+	d := NewBundleDecoder(strings.NewReader("hXzRNEzmMuzKkT1HCxUb:" + body))
+	m, err := d.Next()
+	if err != nil || m.Message != body {
+		t.Error("Large message not decoded")
+	}
+}
+
+func TestIndexDecoderStrict(t *testing.T) {
+	tests := []struct {
+		index string
+		line  int
+	}{
+		{"ii.test.14\nhXzRNEzmMuzKkT1HCxUb\n\npipe.2032\nJN3ylpxjaNofxgPy6NhL\n", 0},
+		{"hXzRNEzmMuzKkT1HCxUb\nii.test.14\n", 1},
+		{"ii.test.14\nhXzRNEzmMuzKkT1HCxUb\nhXzRNEzmMuzKkT1HC+Ub\n", 3},
+		{"ii.test.14\nhXzRNEzmMuzKkT1HCxUb\nii/test:14\n", 3},
+		{"ii.test.14\nhXzRNEzmMuzKkT1HCxU\n", 2},
+		{"ii.test.14:12\n", 1},
+	}
+
+	for _, test := range tests {
+		d := NewIndexDecoder(strings.NewReader(test.index))
+		d.Strict = true
+		var err error
+		for err == nil {
+			_, err = d.Next()
+		}
+		if test.line == 0 {
+			if err != io.EOF {
+				t.Errorf("%q: %v", test.index, err)
+			}
+			continue
+		}
+		ie, ok := err.(*IndexError)
+		if !ok {
+			t.Errorf("%q: wrong error %v", test.index, err)
+			continue
+		}
+		if ie.Line != test.line {
+			t.Errorf("%q: wrong error line %d", test.index, ie.Line)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package idec
+
+// Echo names grammar
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Echo name length bounds
+const (
+	MinEchoNameLength = 3
+	MaxEchoNameLength = 120
+)
+
+// EchoName valid IDEC echo area name, e.g. ii.test.14
+type EchoName string
+
+// ParseEchoName validates echo name.
+// Name is 3 to 120 latin letters, digits, '_' and '-'
+// split by dots into at least two non-empty parts.
+// Returns error wrapping ErrBadEcho.
+func ParseEchoName(name string) (EchoName, error) {
+	if len(name) < MinEchoNameLength || len(name) > MaxEchoNameLength {
+		return "", fmt.Errorf("%w %q: length is not %d-%d", ErrBadEcho, name, MinEchoNameLength, MaxEchoNameLength)
+	}
+	for _, c := range name {
+		if !isAlnum(c) && c != '.' && c != '_' && c != '-' {
+			return "", fmt.Errorf("%w %q: character %q is not allowed", ErrBadEcho, name, c)
+		}
+	}
+	parts := strings.Split(name, ".")
+	if len(parts) < 2 {
+		return "", fmt.Errorf("%w %q: no dot", ErrBadEcho, name)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return "", fmt.Errorf("%w %q: empty part", ErrBadEcho, name)
+		}
+	}
+
+	return EchoName(name), nil
+}
+
+// isEchoName checks echo name grammar
+func isEchoName(name string) bool {
+	_, err := ParseEchoName(name)
+	return err == nil
+}
+
+func (e EchoName) String() string {
+	return string(e)
+}
+
+// Parts splits echo name hierarchy, ii.test.14 is [ii test 14]
+func (e EchoName) Parts() []string {
+	return strings.Split(string(e), ".")
+}
+
+// Parent returns echo name without the last part, ii.test.14 is ii.test.
+// Parent of two parts name is its first part.
+func (e EchoName) Parent() string {
+	i := strings.LastIndex(string(e), ".")
+	if i < 0 {
+		return ""
+	}
+	return string(e[:i])
+}
+
+// Match echo name against pattern where '*' matches
+// any characters including dots, e.g. ii.*
+func (e EchoName) Match(pattern string) bool {
+	return MatchEcho(pattern, string(e))
+}
+
+// MatchEcho matches echo name against pattern, see EchoName.Match.
+// Matching is linear, stars backtrack to the last one only.
+func MatchEcho(pattern, echo string) bool {
+	p, e := 0, 0
+	// Last star position and echo position it matched from
+	star, next := -1, 0
+	for e < len(echo) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, e
+			p++
+		case p < len(pattern) && pattern[p] == echo[e]:
+			p++
+			e++
+		case star >= 0:
+			// Last star takes one more character
+			next++
+			p, e = star+1, next
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// MatchEchoes returns echoes matching any of patterns
+// keeping echoes order, e.g. to expand subscriptions with list.txt
+func MatchEchoes(patterns, echoes []string) []string {
+	var matched []string
+	for _, echo := range echoes {
+		for _, p := range patterns {
+			if MatchEcho(p, echo) {
+				matched = append(matched, echo)
+				break
+			}
+		}
+	}
+	return matched
+}
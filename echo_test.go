@@ -0,0 +1,67 @@
+package idec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseEchoName(t *testing.T) {
+	valid := []string{"ii.test.14", "pipe.2032", "bash.rss", "im.100", "ru.linux_talks", "a-b.c"}
+	for _, name := range valid {
+		if _, err := ParseEchoName(name); err != nil {
+			t.Error(err)
+		}
+	}
+
+	invalid := []string{"", "ii", "a.", ".ab", "ii..test", "ii/test.14", "ii.test:14", "ii test.14", "эхо.тест", strings.Repeat("a.", 61)}
+	for _, name := range invalid {
+		if _, err := ParseEchoName(name); !errors.Is(err, ErrBadEcho) {
+			t.Errorf("Invalid echo name %q parsed", name)
+		}
+	}
+}
+
+func TestEchoNameHierarchy(t *testing.T) {
+	e := EchoName("ii.test.14")
+	if strings.Join(e.Parts(), " ") != "ii test 14" {
+		t.Errorf("Wrong parts: %v", e.Parts())
+	}
+	if e.Parent() != "ii.test" || EchoName("pipe.2032").Parent() != "pipe" {
+		t.Errorf("Wrong parent: %s", e.Parent())
+	}
+}
+
+func TestMatchEcho(t *testing.T) {
+	tests := []struct {
+		pattern string
+		echo    string
+		match   bool
+	}{
+		{"ii.*", "ii.test.14", true},
+		{"ii.*", "ii", false},
+		{"ii.*", "pipe.2032", false},
+		{"*.14", "ii.test.14", true},
+		{"ii.*.14", "ii.test.14", true},
+		{"ii.*.14", "ii.test.15", false},
+		{"*", "pipe.2032", true},
+		{"pipe.2032", "pipe.2032", true},
+		{"pipe.2032", "pipe.20321", false},
+		{"ii.**", "ii.", true},
+		{"*a*b", "aab.ab", true},
+		{"*a*b", "aab.aa", false},
+		{"ii*14*", "ii.test.14.14", true},
+		// Backtracking would take exponential time
+		{"*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 100), false},
+	}
+	for _, test := range tests {
+		if EchoName(test.echo).Match(test.pattern) != test.match {
+			t.Errorf("%s matching %s is not %v", test.echo, test.pattern, test.match)
+		}
+	}
+
+	matched := MatchEchoes([]string{"ii.*", "pipe.2032"}, []string{"bash.rss", "ii.test.14", "pipe.2032", "ii.dev"})
+	if strings.Join(matched, ",") != "ii.test.14,pipe.2032,ii.dev" {
+		t.Errorf("Wrong matched echoes: %v", matched)
+	}
+}
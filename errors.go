@@ -0,0 +1,99 @@
+package idec
+
+// Package errors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Parse errors
+var (
+	ErrBadBase64    = errors.New("Bad base64 encoding")
+	ErrTooFewLines  = errors.New("Bad message: too few lines")
+	ErrBadTimestamp = errors.New("Bad message timestamp")
+	ErrBadTags      = errors.New("Bad tagstring")
+	ErrBadRepto     = errors.New("Bad @repto field")
+	ErrBadAddress   = errors.New("Bad address")
+	// ErrBadResponse malformed u/e, x/c or list.txt response
+	ErrBadResponse = errors.New("Bad node response")
+)
+
+// Validation errors, see ValidationError
+var (
+	ErrEmptyField = errors.New("field is empty")
+	ErrNotEmpty   = errors.New("field is not empty")
+	ErrBadEcho    = errors.New("wrong echo name")
+	ErrBadLength  = errors.New("wrong field length")
+	ErrTooLong    = errors.New("field is too long")
+	ErrBadValue   = errors.New("wrong field value")
+	ErrTooOld     = errors.New("date is before IDEC")
+	ErrFutureDate = errors.New("date is in the future")
+)
+
+// Node errors
+var (
+	// ErrNotSupported feature is not announced in x/features
+	ErrNotSupported = errors.New("Node does not support")
+	// ErrIDMismatch message does not hash to its id, see IDMismatchError
+	ErrIDMismatch = errors.New("message id mismatch")
+	// ErrMissing node response lacks requested messages
+	ErrMissing = errors.New("node did not return messages")
+	// ErrNotFound message is missing in storage
+	ErrNotFound = errors.New("message not found")
+)
+
+// ValidationError invalid message field
+type ValidationError struct {
+	Field string
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors all invalid fields of message
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	var s []string
+	for _, err := range e {
+		s = append(s, err.Error())
+	}
+	return strings.Join(s, "; ")
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	var errs []error
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// check adds field error if failed
+func (e *ValidationErrors) check(field string, failed bool, err error) {
+	if failed {
+		*e = append(*e, &ValidationError{field, err})
+	}
+}
+
+// maxNodeErrorBody node response body length kept in NodeError
+const maxNodeErrorBody = 512
+
+// NodeError node rejected request
+type NodeError struct {
+	URL        string
+	StatusCode int
+	Body       string
+}
+
+func (e *NodeError) Error() string {
+	return fmt.Sprintf("Error from node %s: %d: %s", e.URL, e.StatusCode, strings.TrimSpace(e.Body))
+}
@@ -0,0 +1,24 @@
+package idec
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestValidationError(t *testing.T) {
+	err := fmt.Errorf("message: %w", &ValidationError{"To", ErrEmptyField})
+	if err.Error() != "message: To: field is empty" {
+		t.Errorf("Wrong error text: %s", err)
+	}
+	if !errors.Is(err, ErrEmptyField) {
+		t.Error("Validation error does not wrap reason")
+	}
+}
+
+func TestNodeError(t *testing.T) {
+	err := &NodeError{"http://localhost/idec/u/point", 403, "error: wrong authstring\n"}
+	if err.Error() != "Error from node http://localhost/idec/u/point: 403: error: wrong authstring" {
+		t.Errorf("Wrong error text: %s", err)
+	}
+}
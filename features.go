@@ -0,0 +1,87 @@
+package idec
+
+import (
+	"strings"
+)
+
+// Node features announced in x/features
+const (
+	FeatureListTXT      = "list.txt"
+	FeatureBlacklistTXT = "blacklist.txt"
+	FeatureXCount       = "x/c"
+	FeatureUEcho        = "u/e"
+	FeatureUPush        = "u/push"
+	FeatureXFile        = "x/file"
+	FeatureXFileList    = "x/filelist"
+)
+
+// Features node features set
+type Features struct {
+	ListTXT      bool `json:"list_txt"`
+	BlacklistTXT bool `json:"blacklist_txt"`
+	XCount       bool `json:"xcount"`
+	UEcho        bool `json:"u_e"`
+	UPush        bool `json:"u_push"`
+	XFile        bool `json:"x_file"`
+	XFileList    bool `json:"x_filelist"`
+	// Unknown features as announced by node
+	Unknown []string `json:"unknown"`
+}
+
+// ParseFeatures parse x/features response
+func ParseFeatures(features string) Features {
+	var f Features
+	for _, line := range strings.Split(features, "\n") {
+		name := strings.TrimSpace(line)
+		if name == "" {
+			continue
+		}
+		if flag := f.flag(name); flag != nil {
+			*flag = true
+			continue
+		}
+		f.Unknown = append(f.Unknown, name)
+	}
+
+	return f
+}
+
+// featureName normalizes feature name, e.g. x/c/ is x/c
+func featureName(name string) string {
+	return strings.TrimRight(strings.TrimSpace(name), "/")
+}
+
+// flag returns pointer to known feature flag or nil
+func (f *Features) flag(name string) *bool {
+	switch featureName(name) {
+	case FeatureListTXT:
+		return &f.ListTXT
+	case FeatureBlacklistTXT:
+		return &f.BlacklistTXT
+	case FeatureXCount:
+		return &f.XCount
+	case FeatureUEcho:
+		return &f.UEcho
+	case FeatureUPush:
+		return &f.UPush
+	case FeatureXFile:
+		return &f.XFile
+	case FeatureXFileList:
+		return &f.XFileList
+	}
+	return nil
+}
+
+// Supports reports whether node announced the feature
+func (f Features) Supports(name string) bool {
+	if flag := f.flag(name); flag != nil {
+		return *flag
+	}
+	name = featureName(name)
+	for _, u := range f.Unknown {
+		if featureName(u) == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,35 @@
+package idec
+
+import (
+	"testing"
+)
+
+func TestParseFeatures(t *testing.T) {
+	f := ParseFeatures(`list.txt
+blacklist.txt
+u/e
+u/m/
+x/c
+u/push
+x/file
+x/filelist
+`)
+	if !f.ListTXT || !f.BlacklistTXT || !f.UEcho || !f.XCount || !f.UPush || !f.XFile || !f.XFileList {
+		t.Errorf("Wrong features parsing: %+v", f)
+	}
+	if len(f.Unknown) != 1 || f.Unknown[0] != "u/m/" {
+		t.Errorf("Unknown feature not kept: %v", f.Unknown)
+	}
+	if !f.Supports(FeatureXCount) || !f.Supports("u/m/") || !f.Supports("u/m") || !f.Supports("x/c/") {
+		t.Error("Supported feature not found")
+	}
+	if f.Supports("x/other") {
+		t.Error("Unsupported feature found")
+	}
+
+	// Substring must not match
+	f = ParseFeatures("x/filelist.txt\n")
+	if f.ListTXT || f.XFileList {
+		t.Errorf("Wrong features parsing: %+v", f)
+	}
+}
@@ -1,3 +1,5 @@
 module github.com/idec-net/go-idec
 
+go 1.20
+
 require gopkg.in/jarcoal/httpmock.v1 v1.0.0-20190304095222-3b6b0a8dbc05
@@ -1,10 +1,11 @@
 package idec
 
 import (
-	"encoding/base64"
-	"errors"
+	"encoding/json"
 	"net/url"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // Message IDEC message structure
@@ -16,9 +17,46 @@ type Message struct {
 	Subg      string `json:"subg"`
 	ID        string `json:"id"`
 	Timestamp int    `json:"timestamp"`
-	Body      string `json:"body"`
-	Tags      Tags   `json:"tags"`
-	Repto     string `json:"repto"`
+	// Body text after header lines, see Normalize
+	Body string `json:"body"`
+	// Tags in original order, repto tag is the replied message id
+	Tags Tags `json:"tags"`
+	// Variant base64 variant message was received in
+	Variant Base64Variant `json:"-"`
+	// Charset original legacy charset, empty for UTF-8
+	Charset Charset `json:"charset,omitempty"`
+}
+
+// Message limits checked by Message.Validate
+const (
+	MaxNameLength    = 50
+	MaxSubjectLength = 256
+	MaxBodySize      = 64 * 1024
+)
+
+// Validate bundled message, e.g. pushed to node
+// Returns ValidationErrors with all invalid fields
+func (m Message) Validate() error {
+	repto := m.Repto()
+
+	var errs ValidationErrors
+	errs.check("Tags", m.Tags.II() == "", ErrEmptyField)
+	errs.check("Echo", m.Echo == "", ErrEmptyField)
+	errs.check("Echo", m.Echo != "" && !isEchoName(m.Echo), ErrBadEcho)
+	errs.check("From", m.From == "", ErrEmptyField)
+	errs.check("From", utf8.RuneCountInString(m.From) > MaxNameLength, ErrTooLong)
+	errs.check("To", m.To == "", ErrEmptyField)
+	errs.check("To", utf8.RuneCountInString(m.To) > MaxNameLength, ErrTooLong)
+	errs.check("Subg", m.Subg == "", ErrEmptyField)
+	errs.check("Subg", utf8.RuneCountInString(m.Subg) > MaxSubjectLength, ErrTooLong)
+	errs.check("Timestamp", m.Timestamp <= 0, ErrBadValue)
+	errs.check("ID", m.ID != "" && !isMsgID(m.ID), ErrBadValue)
+	errs.check("Repto", repto != "" && !isMsgID(repto), ErrBadValue)
+	errs.check("Body", len(m.Body) > MaxBodySize, ErrTooLong)
+	if errs != nil {
+		return errs
+	}
+	return nil
 }
 
 // PointMessage
@@ -29,62 +67,122 @@ type PointMessage struct {
 	EmptyLine string `json:"empty_line"`
 	Repto     string `json:"repto"`
 	Body      string `json:"body"`
+	// Variant base64 variant message was received in
+	Variant Base64Variant `json:"-"`
 }
 
-// Tags IDEC message tags
-type Tags struct {
-	II    string `json:"ii"`
-	Repto string `json:"repto"`
+// Repto returns id of the message this one replies to, see Tags.Repto
+func (m Message) Repto() string {
+	return m.Tags.Repto()
 }
 
-// CollectTags make ii/ok message from Tags
-func (t Tags) CollectTags() (string, error) {
-	var tagstring string
-	if t.II == "" {
-		e := errors.New("Wrong ii/ok tag")
-		return "", e
+// SetRepto sets repto tag, empty msgid removes it
+func (m *Message) SetRepto(msgid string) {
+	m.Tags = append(Tags(nil), m.Tags...)
+	m.Tags.Set(tagRepto, msgid)
+}
+
+// Normalize returns message in the form ParseMessage returns:
+// Body starts with the empty separator line end unless empty.
+//
+// Messages render normalized, so for UTF-8 message with header fields
+// and tags without '\n' and empty ID and Variant:
+//
+//	ParseMessage(m.Bundle()) == m.Normalize()
+func (m Message) Normalize() Message {
+	if m.Body != "" && !strings.HasPrefix(m.Body, "\n") {
+		m.Body = "\n" + m.Body
 	}
-	if t.Repto == "" {
-		tagstring = strings.Join([]string{"ii", t.II}, "/")
-	} else {
-		tagstring = strings.Join([]string{"ii", t.II, "repto", t.Repto}, "/")
+	return m
+}
+
+// Raw renders plain bundled message text of normalized message,
+// see Normalize. Legacy charset messages are rendered in their Charset.
+func (m Message) Raw() (string, error) {
+	m = m.Normalize()
+	strTags, err := m.Tags.CollectTags()
+	if err != nil {
+		return "", err
+	}
+
+	raw := strings.Join([]string{strTags, m.Echo, strconv.Itoa(m.Timestamp),
+		m.From, m.Address, m.To, m.Subg}, "\n") + "\n" + m.Body
+	if m.Charset == "" {
+		return raw, nil
 	}
-	return tagstring, nil
+
+	// Original bytes keep message id
+	b, err := EncodeCharset(raw, m.Charset)
+	if err != nil {
+		return "", &ValidationError{"Charset", err}
+	}
+	return string(b), nil
 }
 
-// Make bundle from point message
-// func (p PointMessage) MakeBundleMessage(from, address string) (*Message, string, error) {
-// 	var result string
-// 	var message *Message
+// Bundle renders base64 bundled message
+func (m Message) Bundle() (string, error) {
+	return m.BundleVariant(0)
+}
 
-// 	nodeTime := strconv.Itoa(int(time.Now().Unix()))
-// 	tags := Tags{"ok", p.Repto}
+// BundleVariant renders bundled message in base64 variant a peer expects
+func (m Message) BundleVariant(v Base64Variant) (string, error) {
+	raw, err := m.Raw()
+	if err != nil {
+		return "", err
+	}
+	return EncodeBase64([]byte(raw), v), nil
+}
 
-// 	message.Tags = tags
-// 	message.Echo = p.Echo
-// 	message.Timestamp = int(time.Now().Unix())
-// 	message.From = from
-// 	message.Address = address
-// 	message.To = p.To
-// 	message.Subg = p.Subg
-// 	message.Body = p.Body
+// MarshalText encodes Message into base64 bundled message
+func (m Message) MarshalText() ([]byte, error) {
+	b, err := m.Bundle()
+	return []byte(b), err
+}
 
-// 	strTags, err := tags.CollectTags()
-// 	if err != nil {
-// 		return message, "", err
-// 	}
-// 	rawMessage := strings.Join([]string{strTags, p.Echo,
-// 		nodeTime, from, address, p.To, p.Subg, p.EmptyLine, p.Body}, "\n")
+// UnmarshalText decodes base64 bundled message, see ParseMessage
+func (m *Message) UnmarshalText(text []byte) error {
+	msg, err := ParseMessage(string(text))
+	if err != nil {
+		return err
+	}
+	*m = msg
+	return nil
+}
 
-// 	result = base64.StdEncoding.EncodeToString([]byte(rawMessage))
+// MarshalJSON keeps Message JSON object form
+// instead of MarshalText one. repto is the repto tag value.
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	return json.Marshal(struct {
+		message
+		Repto string `json:"repto"`
+	}{message(m), m.Repto()})
+}
 
-// 	return message, result, nil
-// }
+// UnmarshalJSON decodes Message JSON object.
+// repto is set as repto tag if tags have none.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	v := struct {
+		*message
+		Repto string `json:"repto"`
+	}{message: (*message)(m)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.Repto != "" && m.Repto() == "" {
+		m.SetRepto(v.Repto)
+	}
+	return nil
+}
 
 // PrepareMessageForSend Make base64 encoded message. Client.
 func (p *PointMessage) PrepareMessageForSend() string {
-	var result string
+	return p.PrepareMessageForSendVariant(0)
+}
 
+// PrepareMessageForSendVariant makes message in base64 variant node expects
+func (p *PointMessage) PrepareMessageForSendVariant(v Base64Variant) string {
 	var rawMessage string
 	if p.Repto != "" {
 		rawMessage = strings.Join([]string{p.Echo, p.To, p.Subg, p.EmptyLine, p.Repto, p.Body}, "\n")
@@ -92,7 +190,5 @@ func (p *PointMessage) PrepareMessageForSend() string {
 		rawMessage = strings.Join([]string{p.Echo, p.To, p.Subg, p.EmptyLine, p.Body}, "\n")
 	}
 
-	result = base64.StdEncoding.EncodeToString([]byte(rawMessage))
-
-	return url.QueryEscape(result)
+	return url.QueryEscape(EncodeBase64([]byte(rawMessage), v))
 }
@@ -1,14 +1,15 @@
 package idec
 
 import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
 )
 
 func TestCollectTags(t *testing.T) {
-	tags := Tags{
-		II:    "ok",
-		Repto: "hXzRNEzmMuzKkT1HCxUb",
-	}
+	tags := NewTags("ok", "hXzRNEzmMuzKkT1HCxUb")
 	collected, err := tags.CollectTags()
 	if err != nil {
 		t.Error(err)
@@ -18,13 +19,13 @@ func TestCollectTags(t *testing.T) {
 		t.Error("Wrong tags collection")
 	}
 	// Without repto
-	tags.Repto = ""
+	tags.Set("repto", "")
 	collected, err = tags.CollectTags()
 	if collected != "ii/ok" {
 		t.Error("Wrong tags collection")
 	}
 	// Wrong ii/ok
-	tags.II = ""
+	tags.Set("ii", "")
 	_, err = tags.CollectTags()
 	if err == nil {
 		t.Error("Wrong tags collection")
@@ -54,3 +55,176 @@ func TestPrepareMessageForSend(t *testing.T) {
 		t.Error("Messages with and without repto is equal!")
 	}
 }
+
+func TestMessageRender(t *testing.T) {
+	bundles := []string{
+		`aWkvb2svcmVwdG8vdFU3SjBienVMMnI0RG9zRGtOUE8KcGlwZS4yMDMyCjE1NTE2ODk3NjYKRGlmcmV4CmR5bmFtaWMsMQpEaWZyZXgKUmU6IGlkZWMKCtCY0LvQuCDQtNCw0LbQtSDRgtCw0Lo6Cj09PT0KY3VybCAtWFBPU1QgLUggIlgtSWRlYy1QYXV0aDogc2Rsa2RzZmprbHNkZiIgLVQgL2V0Yy9wYXNzd2QgaWRlYy5ub2RlL3gvZC9tc2dpZAo9PT09`,
+		`aWkvb2svcmVwdG8vSk4zeWxweGphTm9meGdQeTZOaEwKaWkudGVzdC4xNAoxNTUxNjk5NjE0CkRpZnJleApkeW5hbWljLDEKRGlmcmV4ClJlOiBpZGVjCgpzZGZnc2ZkZyBzZGdmCgpmZGcgc2dmIHMKCmZkZyBzZGZnIHMKc2RmZyBzZGZnIHMKCgoKc2ZkZ2dnZ2dnZ2dnZ2dnZ2dnZ2dnZ2dnZ2dnZ2dnZ2dnZ2dnZ2dnZ2dnZ2dnZ2dn`,
+		testBundle("ii.test.14", "Test message"),
+	}
+
+	for _, b := range bundles {
+		m, err := ParseMessage(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rendered, err := m.Bundle()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rendered != b {
+			t.Errorf("Bundle %s rendered as %s", b, rendered)
+		}
+
+		var parsed Message
+		text, err := m.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := parsed.UnmarshalText(text); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(parsed, m) {
+			t.Errorf("Message %+v parsed as %+v", m, parsed)
+		}
+	}
+}
+
+// Messages built in code parse back normalized
+func TestMessageRenderParse(t *testing.T) {
+	base := Message{
+		Tags:      NewTags("ok", ""),
+		Echo:      "ii.test.14",
+		Timestamp: 1551689766,
+		From:      "Difrex",
+		Address:   "dynamic,1",
+		To:        "All",
+		Subg:      "test",
+	}
+	tagged := base
+	tagged.Tags, _ = ParseTags("ii/ok/x/1/repto/hXzRNEzmMuzKkT1HCxUb")
+
+	var tests []Message
+	for _, body := range []string{"", "hello", "\nhello", "\n", "hello\n\nworld\n", "\n\nhello"} {
+		m := base
+		m.Body = body
+		tests = append(tests, m)
+	}
+	repto := base
+	repto.Body = "reply"
+	repto.SetRepto("hXzRNEzmMuzKkT1HCxUb")
+	tests = append(tests, repto, tagged)
+
+	for _, m := range tests {
+		bundle, err := m.Bundle()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := ParseMessage(bundle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(parsed, m.Normalize()) {
+			t.Errorf("Message %+v parsed as %+v", m.Normalize(), parsed)
+		}
+		if again, _ := parsed.Bundle(); again != bundle {
+			t.Errorf("Normalized message %+v rendered as %s", parsed, again)
+		}
+	}
+}
+
+func TestMessageRaw(t *testing.T) {
+	m := Message{
+		Tags:      NewTags("ok", "tU7J0bzuL2r4DosDkNPO"),
+		Echo:      "ii.test.14",
+		Timestamp: 1551689766,
+		From:      "Difrex",
+		Address:   "dynamic,1",
+		To:        "All",
+		Subg:      "Test",
+		Body:      "Body line",
+	}
+	raw, err := m.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "ii/ok/repto/tU7J0bzuL2r4DosDkNPO\nii.test.14\n1551689766\nDifrex\ndynamic,1\nAll\nTest\n\nBody line"
+	if raw != want {
+		t.Errorf("Wrong raw message:\n%s", raw)
+	}
+
+	// Body without separator line is the same message
+	m.Body = "\nBody line"
+	if raw2, _ := m.Raw(); raw2 != raw {
+		t.Errorf("Wrong raw message:\n%s", raw2)
+	}
+
+	m.Tags.Set("ii", "")
+	if _, err := m.Raw(); err == nil {
+		t.Error("Bad tags rendered")
+	}
+}
+
+func TestMessageJSON(t *testing.T) {
+	m := Message{Echo: "ii.test.14", Tags: NewTags("ok", "")}
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"echo":"ii.test.14"`) {
+		t.Errorf("Wrong JSON: %s", b)
+	}
+	var parsed Message
+	if err := json.Unmarshal(b, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, m) {
+		t.Errorf("Wrong JSON decoding: %+v", parsed)
+	}
+
+	// repto is the repto tag value
+	m.SetRepto("hXzRNEzmMuzKkT1HCxUb")
+	b, err = json.Marshal(m)
+	if err != nil || !strings.Contains(string(b), `"repto":"hXzRNEzmMuzKkT1HCxUb"`) {
+		t.Errorf("Wrong JSON: %s %v", b, err)
+	}
+	parsed = Message{}
+	if err := json.Unmarshal([]byte(`{"echo":"ii.test.14","tags":[{"key":"ii","value":"ok"}],"repto":"hXzRNEzmMuzKkT1HCxUb"}`), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(parsed, m) {
+		t.Errorf("Wrong JSON repto decoding: %+v", parsed)
+	}
+}
+
+func TestMessageValidate(t *testing.T) {
+	m, err := ParseMessage(testBundle("ii.test.14", "Test message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.ID = "hXzRNEzmMuzKkT1HCxUb"
+	if err := m.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	m.Echo = "ii/test"
+	m.From = strings.Repeat("ф", MaxNameLength+1)
+	m.To = ""
+	m.Subg = strings.Repeat("s", MaxSubjectLength+1)
+	m.Timestamp = 0
+	m.ID = "hXzRNEzmMuzKkT1HC+Ub"
+	m.SetRepto("short")
+	m.Body = strings.Repeat("b", MaxBodySize+1)
+
+	var errs ValidationErrors
+	if !errors.As(m.Validate(), &errs) {
+		t.Fatal("Invalid message validated")
+	}
+	var fields []string
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	if strings.Join(fields, ",") != "Echo,From,To,Subg,Timestamp,ID,Repto,Body" {
+		t.Errorf("Wrong invalid fields: %v", fields)
+	}
+}
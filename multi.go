@@ -0,0 +1,129 @@
+package idec
+
+// Multi-node fetch with failover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// SourcedMSG message with the node it was fetched from
+type SourcedMSG struct {
+	MSG
+	Node string `json:"node"`
+}
+
+// MultiFetcher fetches echoes from several nodes.
+// Each message is downloaded once from the first node
+// having it and from the next ones if that fails.
+type MultiFetcher struct {
+	// Nodes with their echoes. Offset and Limit are used if Limit is set.
+	Nodes []FetchConfig
+	// HTTPClient used for all nodes. http.DefaultClient if nil.
+	HTTPClient *http.Client
+	// Have reports messages already stored. Optional.
+	Have func(msgid string) bool
+}
+
+// node fetch state
+type multiNode struct {
+	config FetchConfig
+	client *Client
+	ids    map[string]bool
+}
+
+// Fetch fetches missing messages from all nodes in union index order.
+// If some messages could not be fetched from any node
+// the rest is returned with error.
+func (f *MultiFetcher) Fetch(ctx context.Context) ([]SourcedMSG, error) {
+	var nodes []*multiNode
+	var union []ID
+	var errs []error
+	seen := make(map[string]bool)
+
+	for _, n := range f.Nodes {
+		c := n.Client(f.HTTPClient)
+
+		var ids []ID
+		var err error
+		if n.Limit != 0 {
+			ids, err = c.GetMessagesIDS(ctx, n.Echoes, n.Offset, n.Limit)
+		} else {
+			ids, err = c.GetAllMessagesIDS(ctx, n.Echoes)
+		}
+		// Node is unavailable, use others
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", n.Node, err))
+			continue
+		}
+
+		node := &multiNode{n, c, make(map[string]bool)}
+		for _, id := range ids {
+			node.ids[id.MsgID] = true
+			if seen[id.MsgID] || f.Have != nil && f.Have(id.MsgID) {
+				continue
+			}
+			seen[id.MsgID] = true
+			union = append(union, id)
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 && len(f.Nodes) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	fetched := make(map[string]SourcedMSG)
+	pending := union
+	for _, node := range nodes {
+		var ids []ID
+		for _, id := range pending {
+			if node.ids[id.MsgID] {
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		msgs, err := NewBatchFetcher(node.client).GetRawMessages(ctx, ids)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", node.config.Node, err))
+		}
+		for _, m := range msgs {
+			fetched[m.ID] = SourcedMSG{m, node.config.Node}
+		}
+		if err := ctx.Err(); err != nil {
+			return ordered(union, fetched), err
+		}
+
+		// Failed and not returned ids go to the next nodes
+		var rest []ID
+		for _, id := range pending {
+			if _, ok := fetched[id.MsgID]; !ok {
+				rest = append(rest, id)
+			}
+		}
+		pending = rest
+	}
+
+	// Node failures are reported only if messages are lost
+	messages := ordered(union, fetched)
+	if len(messages) < len(union) {
+		errs = append(errs, fmt.Errorf("%d of %d messages not fetched", len(union)-len(messages), len(union)))
+		return messages, errors.Join(errs...)
+	}
+	return messages, nil
+}
+
+// ordered returns fetched messages in ids order
+func ordered(ids []ID, fetched map[string]SourcedMSG) []SourcedMSG {
+	var messages []SourcedMSG
+	for _, id := range ids {
+		if m, ok := fetched[id.MsgID]; ok {
+			messages = append(messages, m)
+		}
+	}
+	return messages
+}
@@ -0,0 +1,60 @@
+package idec
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+func TestMultiFetcher(t *testing.T) {
+	mock := httpmock.NewMockTransport()
+	mock.RegisterResponder("GET", "http://node1/u/e/ii.test.14", httpmock.NewStringResponder(200, "ii.test.14\nhXzRNEzmMuzKkT1HCxUb\nJN3ylpxjaNofxgPy6NhL\n"))
+	mock.RegisterResponder("GET", "http://node2/u/e/ii.test.14", httpmock.NewStringResponder(200, "ii.test.14\nJN3ylpxjaNofxgPy6NhL\nxF3kkmrZYld330BO7qaA\n3uS3uij0Y4AUnSxhf4WB\n"))
+	mock.RegisterResponder("GET", "http://node3/u/e/ii.test.14", httpmock.NewStringResponder(500, "Internal Server Error"))
+	retry := &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, RetryStatus: []int{500, 502}}
+
+	// node1 fails, node2 supplies everything except stored message
+	mock.RegisterResponder("GET", "http://node1/u/m/hXzRNEzmMuzKkT1HCxUb/JN3ylpxjaNofxgPy6NhL", httpmock.NewStringResponder(502, "Bad Gateway"))
+	mock.RegisterResponder("GET", "http://node2/u/m/JN3ylpxjaNofxgPy6NhL/xF3kkmrZYld330BO7qaA", httpmock.NewStringResponder(200, "JN3ylpxjaNofxgPy6NhL:Yg==\nxF3kkmrZYld330BO7qaA:Yw==\n"))
+
+	f := &MultiFetcher{
+		Nodes: []FetchConfig{
+			{Node: "http://node3/", Echoes: []string{"ii.test.14"}, Retry: retry},
+			{Node: "http://node1/", Echoes: []string{"ii.test.14"}, Retry: retry},
+			{Node: "http://node2/", Echoes: []string{"ii.test.14"}, Retry: retry},
+		},
+		HTTPClient: &http.Client{Transport: mock},
+		Have: func(msgid string) bool {
+			return msgid == "3uS3uij0Y4AUnSxhf4WB"
+		},
+	}
+
+	msgs, err := f.Fetch(context.Background())
+	if err == nil {
+		t.Fatal("Lost message not reported")
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("Wrong messages: %v", msgs)
+	}
+	if msgs[0].ID != "JN3ylpxjaNofxgPy6NhL" || msgs[0].Node != "http://node2/" || msgs[1].ID != "xF3kkmrZYld330BO7qaA" {
+		t.Errorf("Wrong messages: %v", msgs)
+	}
+	// Nodes share FetchConfig retry policy
+	if n := mock.GetCallCountInfo()["GET http://node3/u/e/ii.test.14"]; n != 2 {
+		t.Errorf("Failed node is requested %d times", n)
+	}
+
+	// node1 recovers
+	mock.RegisterResponder("GET", "http://node1/u/m/hXzRNEzmMuzKkT1HCxUb/JN3ylpxjaNofxgPy6NhL", httpmock.NewStringResponder(200, "hXzRNEzmMuzKkT1HCxUb:YQ==\nJN3ylpxjaNofxgPy6NhL:Yg==\n"))
+	mock.RegisterResponder("GET", "http://node2/u/m/xF3kkmrZYld330BO7qaA", httpmock.NewStringResponder(200, "xF3kkmrZYld330BO7qaA:Yw==\n"))
+	msgs, err = f.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 3 || msgs[0].Node != "http://node1/" || msgs[1].Node != "http://node1/" || msgs[2].Node != "http://node2/" {
+		t.Errorf("Wrong messages: %v", msgs)
+	}
+}
@@ -1,133 +1,238 @@
 package idec
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"net/url"
-
-	"errors"
 )
 
-// ParseMessage ...
+// Bundled message header lines count
+const messageHeaderLines = 7
+
+// ParseMessage parse base64 bundled message.
+// Wrapped, URL-safe and unpadded base64 is accepted, see DecodeBase64.
+// Returns zero Message and one of Err* parse errors on failure.
 func ParseMessage(message string) (Message, error) {
-	var m Message
-	plainMessage, err := base64.StdEncoding.DecodeString(message)
+	plainMessage, variant, err := DecodeBase64(message)
 	if err != nil {
-		return m, err
+		return Message{}, err
 	}
+	m, err := parseMessage(plainMessage)
+	if err != nil {
+		return Message{}, err
+	}
+	m.Variant = variant
+	return m, nil
+}
 
-	txtMessage := strings.Split(string(plainMessage), "\n")
+// ParseMessageBytes parse base64 bundled message, see ParseMessage
+func ParseMessageBytes(message []byte) (Message, error) {
+	plainMessage := make([]byte, base64.StdEncoding.DecodedLen(len(message)))
+	n, err := base64.StdEncoding.Decode(plainMessage, message)
+	if err != nil {
+		// Other variants
+		return ParseMessage(string(message))
+	}
+	return parseMessage(plainMessage[:n])
+}
 
-	var body string
-	for i := 8; i < len(txtMessage); i++ {
-		body = strings.Join([]string{body, txtMessage[i]}, "\n")
+// ParsePlainMessage parse plain, not base64 encoded, bundled message
+func ParsePlainMessage(plain []byte) (Message, error) {
+	return parseMessage(plain)
+}
+
+// parseMessage parse plain bundled message in a single pass.
+// Lines are split on plain, then message text is copied once
+// and fields are its substrings.
+// Legacy charset messages are transcoded to UTF-8, see DetectCharset.
+func parseMessage(plain []byte) (Message, error) {
+	var charset Charset
+	if !utf8.Valid(plain) {
+		charset = DetectCharset(plain)
+		if charset != "" {
+			plain = []byte(DecodeCharset(plain, charset))
+		}
+	}
+
+	var ends [messageHeaderLines]int
+	// Last header line may be unterminated
+	n := lineEnds(plain, ends[:])
+	if n < messageHeaderLines-1 {
+		return Message{}, ErrTooFewLines
 	}
+	text := string(plain)
+	var header [messageHeaderLines]string
+	rest := splitLines(text, ends[:], header[:])
 
-	ts, err := strconv.Atoi(txtMessage[2])
+	tags, err := ParseTags(header[0])
 	if err != nil {
-		return m, err
+		return Message{}, err
 	}
 
-	tags, err := ParseTags(txtMessage[0])
+	ts, err := strconv.Atoi(header[2])
+	if err != nil {
+		return Message{}, fmt.Errorf("%w: %q", ErrBadTimestamp, header[2])
+	}
 
-	m.Tags = tags
-	m.Echo = txtMessage[1]
-	m.Timestamp = ts
-	m.From = txtMessage[3]
-	m.Address = txtMessage[4]
-	m.To = txtMessage[5]
-	m.Subg = txtMessage[6]
-	m.Body = body
+	// Body starts with the line end of the empty separator line
+	var body string
+	if i := strings.IndexByte(text[rest:], '\n'); i >= 0 {
+		body = text[rest+i:]
+	}
 
-	return m, err
+	return Message{
+		Tags:      tags,
+		Echo:      header[1],
+		Timestamp: ts,
+		From:      header[3],
+		Address:   header[4],
+		To:        header[5],
+		Subg:      header[6],
+		Body:      body,
+		Charset:   charset,
+	}, nil
 }
 
+// lineEnds fills ends with line end offsets of the first len(ends) lines
+// of text. Returns count of line end terminated lines.
+// Unterminated last line of text ends at its end uncounted.
+func lineEnds(text []byte, ends []int) int {
+	start := 0
+	for i := range ends {
+		j := bytes.IndexByte(text[start:], '\n')
+		if j < 0 {
+			ends[i] = len(text)
+			return i
+		}
+		ends[i] = start + j
+		start = ends[i] + 1
+	}
+	return len(ends)
+}
+
+// splitLines fills lines with text lines ending at ends, see lineEnds.
+// Returns offset of text after them.
+func splitLines(text string, ends []int, lines []string) int {
+	start := 0
+	for i, end := range ends {
+		lines[i] = text[start:end]
+		start = end + 1
+	}
+	if start > len(text) {
+		return len(text)
+	}
+	return start
+}
+
+// Point message header lines count, @repto line included
+const pointHeaderLines = 5
+
 // ParsePointMessage ...
 func ParsePointMessage(message string) (*PointMessage, error) {
-	var pointMessage *PointMessage
 	// Unescape message
 	unsafe, err := url.QueryUnescape(message)
 	if err != nil {
-		return pointMessage, err
+		return nil, fmt.Errorf("%w: %v", ErrBadBase64, err)
 	}
-	plainMessage, err := base64.StdEncoding.DecodeString(unsafe)
+	plainMessage, variant, err := DecodeBase64(unsafe)
 	if err != nil {
-		return pointMessage, err
-	}
-
-	txtMessage := strings.Split(string(plainMessage), "\n")
-	if len(txtMessage) < 6 {
-		e := errors.New("Bad message")
-		return pointMessage, e
+		return nil, err
 	}
 
-	var body string
-	for i := 5; i < len(txtMessage); i++ {
-		body = strings.Join([]string{body, txtMessage[i]}, "\n")
+	var ends [pointHeaderLines]int
+	// Body line is required
+	if n := lineEnds(plainMessage, ends[:]); n < pointHeaderLines {
+		return nil, ErrTooFewLines
 	}
+	text := string(plainMessage)
+	var header [pointHeaderLines]string
+	// Body starts with the @repto line end
+	body := splitLines(text, ends[:], header[:]) - 1
 
-	pointMessage = &PointMessage{
-		Echo:      strings.Trim(txtMessage[0], " "),
-		To:        txtMessage[1],
-		Subg:      txtMessage[2],
-		EmptyLine: txtMessage[3],
-		Body:      body,
+	pointMessage := &PointMessage{
+		Echo:      strings.Trim(header[0], " "),
+		To:        header[1],
+		Subg:      header[2],
+		EmptyLine: header[3],
+		Variant:   variant,
 	}
-	if !strings.Contains(txtMessage[4], "@repto:") {
-		pointMessage.Body = txtMessage[4] + "\n" + pointMessage.Body
-		pointMessage.Repto = ""
+	repto, err := ParseReptoFieldErr(header[4])
+	if err != nil {
+		// Not a @repto line is the body first line
+		body -= len(header[4])
 	} else {
-		pointMessage.Repto = ParseReptoField(txtMessage[4])
+		pointMessage.Repto = repto
 	}
+	pointMessage.Body = text[body:]
 
 	return pointMessage, nil
 }
 
 // Validate point message
-// Returns error if one of the message fields is invalid
-// Also, attach repto into body is it does not
+// Returns the first invalid field error, see ValidateAll
 func (p *PointMessage) Validate() error {
-	var err error
-	if p.Echo == "" {
-		err = errors.New("`Echo' field is empty")
-	}
-	if !strings.Contains(p.Echo, ".") {
-		err = errors.New("Wrong Echo name")
+	if errs := p.validate(); errs != nil {
+		return errs[0]
 	}
-	if p.To == "" {
-		err = errors.New("`To' field is empty")
-	}
-	if p.Subg == "" {
-		err = errors.New("`Subg' field is empty")
-	}
-	if p.EmptyLine != "" {
-		err = errors.New("EmptyLine is not empty")
-	}
-	if p.Body == "" {
-		err = errors.New("`Body' field is empty")
-	}
-	if p.Repto != "" && len(p.Repto) != 20 {
-		err = errors.New("Wrong @repto field length")
+	return nil
+}
+
+// ValidateAll point message
+// Returns ValidationErrors with all invalid fields
+func (p *PointMessage) ValidateAll() error {
+	if errs := p.validate(); errs != nil {
+		return errs
 	}
-	return err
+	return nil
+}
+
+func (p *PointMessage) validate() ValidationErrors {
+	var errs ValidationErrors
+	errs.check("Echo", p.Echo == "", ErrEmptyField)
+	errs.check("Echo", p.Echo != "" && !isEchoName(p.Echo), ErrBadEcho)
+	errs.check("To", p.To == "", ErrEmptyField)
+	errs.check("Subg", p.Subg == "", ErrEmptyField)
+	errs.check("EmptyLine", p.EmptyLine != "", ErrNotEmpty)
+	errs.check("Body", p.Body == "", ErrEmptyField)
+	errs.check("Repto", p.Repto != "" && len(p.Repto) != msgIDLength, ErrBadLength)
+	return errs
 }
 
 // ParseReptoField @repto:MSGID, drops @repto prefix
-// and return raw MSGID
+// and return raw MSGID. Returns empty string without prefix,
+// see ParseReptoFieldErr.
 func ParseReptoField(repto string) string {
-	r := strings.Trim(strings.Split(repto, "@repto:")[1], " ")
+	r, _ := ParseReptoFieldErr(repto)
 	return r
 }
 
-// MakeBundledMessage from point message.
+// ParseReptoFieldErr is ParseReptoField returning ErrBadRepto without prefix
+func ParseReptoFieldErr(repto string) (string, error) {
+	i := strings.Index(repto, "@repto:")
+	if i < 0 {
+		return "", ErrBadRepto
+	}
+	r := strings.Split(repto[i+len("@repto:"):], "@repto:")[0]
+	return strings.Trim(r, " "), nil
+}
+
+// MakeBundledMessage from point message dated now.
 // Returns Message with empty From and Address fields
 // you must set this somewhere outside
 func MakeBundledMessage(pointMessage *PointMessage) (Message, error) {
+	return MakeBundledMessageAt(pointMessage, nil)
+}
+
+// MakeBundledMessageAt from point message dated by clock,
+// see MakeBundledMessage
+func MakeBundledMessageAt(pointMessage *PointMessage, clock Clock) (Message, error) {
 	var msg Message
 	t := "ii/ok"
 	if pointMessage.Repto != "" {
@@ -138,35 +243,50 @@ func MakeBundledMessage(pointMessage *PointMessage) (Message, error) {
 		return msg, err
 	}
 	msg = Message{
-		Tags:      tags,
-		Echo:      pointMessage.Echo,
-		Timestamp: int(time.Now().Unix()),
-		To:        pointMessage.To,
-		Subg:      pointMessage.Subg,
-		Repto:     pointMessage.Repto,
-		Body:      pointMessage.Body,
+		Tags: tags,
+		Echo: pointMessage.Echo,
+		To:   pointMessage.To,
+		Subg: pointMessage.Subg,
+		Body: pointMessage.Body,
 	}
+	msg.SetTime(clock.now())
 
 	return msg, nil
 }
 
-// parseTags parse message tags and return Tags struct
-func ParseTags(tags string) (Tags, error) {
-	var t Tags
+// Clock returns current time, time.Now if nil
+type Clock func() time.Time
 
-	if !strings.Contains(tags, "ii/") {
-		e := errors.New("Bad tagstring")
-		return t, e
+// now returns clock time
+func (c Clock) now() time.Time {
+	if c == nil {
+		return time.Now()
 	}
+	return c()
+}
 
-	tagsSlice := strings.Split(tags, "/")
-	if len(tagsSlice) < 4 {
-		t.II = tagsSlice[1]
-		return t, nil
+// Finalize makes complete bundled message from point message
+// posted by authenticated point. Node side.
+// Returns Message with ID and its u/m bundle line id:base64.
+func Finalize(pointMessage *PointMessage, from, address string, clock Clock) (Message, string, error) {
+	if err := pointMessage.Validate(); err != nil {
+		return Message{}, "", err
+	}
+	msg, err := MakeBundledMessageAt(pointMessage, clock)
+	if err != nil {
+		return Message{}, "", err
 	}
-	t.II = tagsSlice[1]
-	t.Repto = tagsSlice[3]
-	return t, nil
+	msg.From = from
+	msg.Address = address
+
+	raw, err := msg.Raw()
+	if err != nil {
+		return Message{}, "", err
+	}
+	msg.ID = MakeMsgID(raw)
+
+	line := MSG{base64.StdEncoding.EncodeToString([]byte(raw)), msg.ID}
+	return msg, line.String(), nil
 }
 
 // ParseEchoList parse /list.txt
@@ -177,9 +297,12 @@ func ParseEchoList(list string) ([]Echo, error) {
 		if len(desc) <= 1 {
 			break
 		}
+		if len(desc) < 3 {
+			return echoes, fmt.Errorf("%w: list.txt line %q", ErrBadResponse, e)
+		}
 		count, err := strconv.Atoi(desc[1])
 		if err != nil {
-			return echoes, err
+			return echoes, fmt.Errorf("%w: list.txt line %q", ErrBadResponse, e)
 		}
 		echoes = append(echoes, Echo{desc[0], count, desc[2]})
 	}
@@ -187,6 +310,40 @@ func ParseEchoList(list string) ([]Echo, error) {
 	return echoes, nil
 }
 
+// ParseEchoCounts parse x/c response
+func ParseEchoCounts(counts string) (map[string]int, error) {
+	result := make(map[string]int)
+	for _, line := range strings.Split(counts, "\n") {
+		if line == "" {
+			continue
+		}
+		c := strings.Split(line, ":")
+		if len(c) != 2 {
+			return result, fmt.Errorf("%w: x/c line %q", ErrBadResponse, line)
+		}
+		count, err := strconv.Atoi(strings.TrimSpace(c[1]))
+		if err != nil {
+			return result, fmt.Errorf("%w: x/c line %q", ErrBadResponse, line)
+		}
+		result[c[0]] = count
+	}
+
+	return result, nil
+}
+
+// ParseBlacklist parse /blacklist.txt
+func ParseBlacklist(list string) Blacklist {
+	b := make(Blacklist)
+	for _, line := range strings.Split(list, "\n") {
+		id := strings.TrimSpace(line)
+		if id != "" {
+			b[id] = struct{}{}
+		}
+	}
+
+	return b
+}
+
 // MakeMsgID from provided plain bundled message
 func MakeMsgID(msg string) string {
 	sum := sha256.Sum256([]byte(msg))
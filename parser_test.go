@@ -2,7 +2,10 @@ package idec
 
 import (
 	"encoding/base64"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseMessage(t *testing.T) {
@@ -11,7 +14,7 @@ func TestParseMessage(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	if msg.Tags.II != "ok" {
+	if msg.Tags.II() != "ok" {
 		t.Error("Bad message tags")
 	}
 
@@ -21,7 +24,7 @@ YywxCkRpZnJleApSZTogaWRlYwoK0JjQu9C4INC00LDQttC1INGC0LDQujoKPT09PQpjdXJsIC1Y
 UE9TVCAtSCAiWC1JZGVjLVBhdXRoOiBzZGxrZHNmamtsc2RmIiAtVCAvZXRjL3Bhc3N3ZCBpZGVj
 Lm5vZGUveC9kL21zZ2lkCj09PT0K`
 	_, err = ParseMessage(m)
-	if err == nil {
+	if !errors.Is(err, ErrBadTimestamp) {
 		t.Error("Wrong time parsing")
 	}
 
@@ -33,6 +36,86 @@ Lm5vZGUveC9kL21zZ2lkCj09PT0K`
 	}
 }
 
+func TestParseMessageMalformed(t *testing.T) {
+	tests := []struct {
+		raw string
+		err error
+	}{
+		{"", ErrTooFewLines},
+		{"ii/ok\npipe.2032\n1551689766", ErrTooFewLines},
+		{"ii/ok\npipe.2032\n1551689766\nDifrex\ndynamic,1\nAll", ErrTooFewLines},
+		{"ok\npipe.2032\n1551689766\nDifrex\ndynamic,1\nAll\nSubj", ErrBadTags},
+		{"ii/ok\npipe.2032\nyesterday\nDifrex\ndynamic,1\nAll\nSubj", ErrBadTimestamp},
+	}
+	for _, test := range tests {
+		m, err := ParseMessage(base64.StdEncoding.EncodeToString([]byte(test.raw)))
+		if !errors.Is(err, test.err) {
+			t.Errorf("%q: got error %v, want %v", test.raw, err, test.err)
+		}
+		if m.Echo != "" {
+			t.Errorf("%q: half-filled message returned", test.raw)
+		}
+	}
+
+	if _, err := ParseMessage("BlaBlaBla"); !errors.Is(err, ErrBadBase64) {
+		t.Errorf("Wrong base64 error: %v", err)
+	}
+
+	// Only header lines
+	m, err := ParseMessage(base64.StdEncoding.EncodeToString([]byte("ii/ok\npipe.2032\n1551689766\nDifrex\ndynamic,1\nAll\nSubj")))
+	if err != nil || m.Subg != "Subj" || m.Body != "" {
+		t.Errorf("Wrong message parsing: %+v, %v", m, err)
+	}
+}
+
+func FuzzParseMessage(f *testing.F) {
+	f.Add(`aWkvb2svcmVwdG8vdFU3SjBienVMMnI0RG9zRGtOUE8KcGlwZS4yMDMyCjE1NTE2ODk3NjYKRGlmcmV4CmR5bmFtaWMsMQpEaWZyZXgKUmU6IGlkZWMKCtCY0LvQuCDQtNCw0LbQtSDRgtCw0Lo6Cj09PT0KY3VybCAtWFBPU1QgLUggIlgtSWRlYy1QYXV0aDogc2Rsa2RzZmprbHNkZiIgLVQgL2V0Yy9wYXNzd2QgaWRlYy5ub2RlL3gvZC9tc2dpZAo9PT09`)
+	f.Add(`aWkvb2svcmVwdG8vdFU3SjBienVMMnI0RG9zRGtOUE8KcGlwZS4yMDMyCgpEaWZyZXgKZHluYW1p
+YywxCkRpZnJleApSZTogaWRlYwoK0JjQu9C4INC00LDQttC1INGC0LDQujoKPT09PQpjdXJsIC1Y
+UE9TVCAtSCAiWC1JZGVjLVBhdXRoOiBzZGxrZHNmamtsc2RmIiAtVCAvZXRjL3Bhc3N3ZCBpZGVj
+Lm5vZGUveC9kL21zZ2lkCj09PT0K`)
+	f.Add(`aWkvb2svcmVwdG8vdFU3SjBienVMMnI0RG9zRGtOUE8KcGlwZS4yMDMyCjE1NTE2ODk3NjYKRGlmcmV4CmR5bmFtaWMsMQpEaWZgKUmU6IGlkZWMKCtCY0LvQuCDQtNCw0LbQtSDRgtCw0Lo6Cj09PT0KY3VybCAtWFBPU1QgLUggIlgtSWRlYy1QYXV0aDogc2Rsa2RzZmprbHNkZiIgLVQgL2V0Yy9wYXNzd2QgaWRlYy5ub2RlL3gvZC9tc2dpZAo9P`)
+	f.Add(base64.StdEncoding.EncodeToString([]byte("ii/ok\npipe.2032\n1551689766")))
+
+	f.Fuzz(func(t *testing.T, message string) {
+		m, err := ParseMessage(message)
+		if err != nil {
+			for _, e := range []error{ErrBadBase64, ErrTooFewLines, ErrBadTimestamp, ErrBadTags} {
+				if errors.Is(err, e) {
+					return
+				}
+			}
+			t.Errorf("Untyped error: %v", err)
+			return
+		}
+		if _, err := m.Raw(); err != nil && !errors.Is(err, ErrBadTags) {
+			t.Errorf("Parsed message not rendered: %v", err)
+		}
+	})
+}
+
+func FuzzParsePointMessage(f *testing.F) {
+	f.Add(base64.StdEncoding.EncodeToString([]byte("ii.test.14\nDifrex\nTest message\n\n@repto:EviyYJSFrnubg0DvckW9\nThis is a message body string.")))
+	f.Add(base64.StdEncoding.EncodeToString([]byte("ii.test.14\nAll\nTest message\nThis is a message body string.")))
+	f.Add("BlaBlaBla")
+
+	f.Add("%zz")
+
+	f.Fuzz(func(t *testing.T, message string) {
+		p, err := ParsePointMessage(message)
+		if err != nil {
+			if !errors.Is(err, ErrBadBase64) && !errors.Is(err, ErrTooFewLines) {
+				t.Errorf("Untyped error: %v", err)
+			}
+			return
+		}
+		var verr *ValidationError
+		if err := p.Validate(); err != nil && !errors.As(err, &verr) {
+			t.Errorf("Untyped validation error: %v", err)
+		}
+	})
+}
+
 func TestParsePointMessage(t *testing.T) {
 	m := `ii.test.14
 Difrex
@@ -114,50 +197,70 @@ This is a message body string.`
 	}
 	// Test wrong echo
 	pmsg.Echo = "invalid"
-	if err := pmsg.Validate(); err != nil && err.Error() != "Wrong Echo name" {
-		t.Error("Validating echo(wrong) field is broken")
-	} else {
-		pmsg.Echo = "ii.test.14"
-	}
+	checkValidationError(t, pmsg.Validate(), "Echo", ErrBadEcho)
 	pmsg.Echo = ""
-	if err := pmsg.Validate(); err != nil && err.Error() != "Wrong Echo name" {
-		t.Error("Validating echo(empty) field is broken: ", err)
-	} else {
-		pmsg.Echo = "ii.test.14"
-	}
+	checkValidationError(t, pmsg.Validate(), "Echo", ErrEmptyField)
 	pmsg.Echo = "ii.test.14"
 	// Test empty to
 	pmsg.To = ""
-	if err := pmsg.Validate(); err != nil && err.Error() != "`To' field is empty" {
-		t.Error("Validating to field is broken")
-	} else {
-		pmsg.To = "Difrex"
-	}
+	checkValidationError(t, pmsg.Validate(), "To", ErrEmptyField)
+	pmsg.To = "Difrex"
 	// Test subg
 	pmsg.Subg = ""
-	if err := pmsg.Validate(); err != nil && err.Error() != "`Subg' field is empty" {
-		t.Error("Validating subg field is broken")
-	} else {
-		pmsg.Subg = "Test message"
-	}
+	checkValidationError(t, pmsg.Validate(), "Subg", ErrEmptyField)
+	pmsg.Subg = "Test message"
 	// Test empty line
 	pmsg.EmptyLine = "not empty"
-	if err := pmsg.Validate(); err != nil && err.Error() != "EmptyLine is not empty" {
-		t.Error("Validating empty line field is broken")
-	} else {
-		pmsg.EmptyLine = ""
-	}
+	checkValidationError(t, pmsg.Validate(), "EmptyLine", ErrNotEmpty)
+	pmsg.EmptyLine = ""
 	// Test body
 	pmsg.Body = ""
-	if err := pmsg.Validate(); err != nil && err.Error() != "`Body' field is empty" {
-		t.Error("Validating body field is broken")
-	} else {
-		pmsg.Body = "\nThis is a message body string."
-	}
+	checkValidationError(t, pmsg.Validate(), "Body", ErrEmptyField)
+	pmsg.Body = "\nThis is a message body string."
 	// Test repto
 	pmsg.Repto = "EviyYJSFrnubg0DvckW"
-	if err := pmsg.Validate(); err != nil && err.Error() != "Wrong @repto field length" {
-		t.Error("Validating repto field is broken")
+	checkValidationError(t, pmsg.Validate(), "Repto", ErrBadLength)
+}
+
+func TestValidateAll(t *testing.T) {
+	p := &PointMessage{
+		Echo:      "",
+		To:        "All",
+		EmptyLine: "not empty",
+		Body:      "Body",
+		Repto:     "EviyYJSFrnubg0DvckW",
+	}
+	if err := p.Validate(); err == nil {
+		t.Fatal("Invalid message validated")
+	}
+
+	err := p.ValidateAll()
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Wrong error: %v", err)
+	}
+	var fields []string
+	for _, e := range errs {
+		fields = append(fields, e.Field)
+	}
+	if strings.Join(fields, ",") != "Echo,Subg,EmptyLine,Repto" {
+		t.Errorf("Wrong invalid fields: %v", fields)
+	}
+	if !errors.Is(err, ErrNotEmpty) || !errors.Is(err, ErrBadLength) {
+		t.Errorf("Wrong validation reasons: %v", err)
+	}
+
+	p = &PointMessage{Echo: "ii.test.14", To: "All", Subg: "Test", Body: "Body"}
+	if err := p.ValidateAll(); err != nil {
+		t.Error(err)
+	}
+}
+
+func checkValidationError(t *testing.T, err error, field string, want error) {
+	t.Helper()
+	var verr *ValidationError
+	if !errors.As(err, &verr) || verr.Field != field || !errors.Is(err, want) {
+		t.Errorf("Validating %s field is broken: %v", field, err)
 	}
 }
 
@@ -166,6 +269,15 @@ func TestParseReptoField(t *testing.T) {
 	if ParseReptoField(repto) != "EviyYJSFrnubg0DvckWa" {
 		t.Error("Can't parse repto field")
 	}
+	if r := ParseReptoField("EviyYJSFrnubg0DvckWa"); r != "" {
+		t.Errorf("Wrong repto field parsed: %s", r)
+	}
+	if r, err := ParseReptoFieldErr(repto); err != nil || r != "EviyYJSFrnubg0DvckWa" {
+		t.Error("Can't parse repto field")
+	}
+	if _, err := ParseReptoFieldErr("EviyYJSFrnubg0DvckWa"); !errors.Is(err, ErrBadRepto) {
+		t.Error("Wrong repto field parsed")
+	}
 }
 
 func TestMakeBundledMessage(t *testing.T) {
@@ -195,12 +307,12 @@ func TestParseTags(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	if tags.II != "ok" {
+	if tags.II() != "ok" {
 		t.Error("Wrong ii tag")
 	}
 	tg = "wrong/tags"
 	tags, err = ParseTags(tg)
-	if err != nil && err.Error() != "Bad tagstring" {
+	if !errors.Is(err, ErrBadTags) {
 		t.Error("Wrong tags parsing")
 	}
 }
@@ -229,7 +341,7 @@ develop.16:402:Обсуждение вопросов программирова
 file.wishes:10:Поиск файлов
 `
 	echoes, err = ParseEchoList(list)
-	if err == nil {
+	if !errors.Is(err, ErrBadResponse) {
 		t.Error("Wrong echoes list parsing")
 	}
 }
@@ -253,3 +365,110 @@ curl -XPOST -H "X-Idec-Pauth: sdlkdsfjklsdf" -T /etc/passwd idec.node/x/d/msgid
 		t.Errorf("id %s not equal %s", id, "Jc0StQZltt2EoHV9fLee")
 	}
 }
+
+func TestParseEchoCounts(t *testing.T) {
+	counts, err := ParseEchoCounts("ii.test.14:5\npipe.2032:1024\n")
+	if err != nil {
+		t.Error(err)
+	}
+	if len(counts) != 2 || counts["pipe.2032"] != 1024 {
+		t.Error("Wrong counts parsing")
+	}
+
+	if _, err := ParseEchoCounts("ii.test.14:five\n"); !errors.Is(err, ErrBadResponse) {
+		t.Error("Wrong count not detected")
+	}
+	if _, err := ParseEchoCounts("ii.test.14\n"); err == nil {
+		t.Error("Bad counter line not detected")
+	}
+}
+
+func TestParseBlacklist(t *testing.T) {
+	b := ParseBlacklist("JN3ylpxjaNofxgPy6NhL\n\n xF3kkmrZYld330BO7qaA \n")
+	if len(b) != 2 || !b.Contains("xF3kkmrZYld330BO7qaA") {
+		t.Error("Wrong blacklist parsing")
+	}
+	ids := b.Filter([]ID{{"ii.test.14", "JN3ylpxjaNofxgPy6NhL"}, {"ii.test.14", "hXzRNEzmMuzKkT1HCxUb"}})
+	if len(ids) != 1 || ids[0].MsgID != "hXzRNEzmMuzKkT1HCxUb" {
+		t.Error("Wrong blacklist filtering")
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	p := &PointMessage{
+		Echo:  "pipe.2032",
+		To:    "Difrex",
+		Subg:  "Re: idec",
+		Repto: "tU7J0bzuL2r4DosDkNPO",
+		Body:  "\nИли даже так:\n====\ncurl -XPOST -H \"X-Idec-Pauth: sdlkdsfjklsdf\" -T /etc/passwd idec.node/x/d/msgid\n====\n",
+	}
+	clock := func() time.Time {
+		return time.Unix(1551689766, 0)
+	}
+
+	msg, line, err := Finalize(p, "Difrex", "dynamic,1", clock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Same message as in TestMakeMsgID
+	if msg.ID != "Jc0StQZltt2EoHV9fLee" {
+		t.Errorf("Wrong message id %s", msg.ID)
+	}
+	if msg.From != "Difrex" || msg.Address != "dynamic,1" || msg.Timestamp != 1551689766 {
+		t.Errorf("Wrong message: %+v", msg)
+	}
+
+	m := NewBundleDecoder(strings.NewReader(line))
+	bundled, err := m.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundled.ID != msg.ID {
+		t.Errorf("Wrong bundle line %s", line)
+	}
+	parsed, err := ParseMessage(bundled.Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Body != p.Body || parsed.Tags.Repto() != p.Repto {
+		t.Errorf("Wrong bundled message: %+v", parsed)
+	}
+
+	// Invalid point message
+	p.Echo = ""
+	if _, _, err := Finalize(p, "Difrex", "dynamic,1", clock); err == nil {
+		t.Error("Invalid message finalized")
+	}
+}
+
+func benchmarkParseMessage(b *testing.B, raw string) {
+	message := base64.StdEncoding.EncodeToString([]byte(raw))
+	b.SetBytes(int64(len(message)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParseMessage(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseMessage(b *testing.B) {
+	benchmarkParseMessage(b, testRaw)
+}
+
+func BenchmarkParseMessage1MB(b *testing.B) {
+	benchmarkParseMessage(b, testRaw+strings.Repeat("Длинное сообщение\n", 1<<20/len("Длинное сообщение\n")))
+}
+
+func BenchmarkParsePointMessage(b *testing.B) {
+	p := &PointMessage{Echo: "ii.test.14", To: "All", Subg: "test", Repto: "hXzRNEzmMuzKkT1HCxUb",
+		Body: strings.Repeat("Длинное сообщение\n", 1<<20/len("Длинное сообщение\n"))}
+	message := p.PrepareMessageForSend()
+	b.SetBytes(int64(len(message)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ParsePointMessage(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -3,12 +3,11 @@ package idec
 // Base IDEC protocol implementation
 
 import (
-	"errors"
-	"fmt"
-	"io/ioutil"
+	"context"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // IDEC Extensions. see: https://ii-net.tk/idec-doc/?p=extensions
@@ -47,6 +46,14 @@ type FetchConfig struct {
 	Num    int      `json:"count"`
 	Offset int      `json:"offset"`
 	Limit  int      `json:"limit"`
+	// Blacklist message ids skipped by fetch calls
+	Blacklist Blacklist `json:"-"`
+	// Verify policy for fetched message ids
+	Verify VerifyPolicy `json:"verify"`
+	// Dates check for fetched messages
+	Dates *DateCheck `json:"dates,omitempty"`
+	// Retry policy, DefaultRetryPolicy if nil
+	Retry *RetryPolicy `json:"-"`
 }
 
 // ID ...
@@ -55,138 +62,100 @@ type ID struct {
 	MsgID string `json:"msgids"`
 }
 
-// GetMessagesIDS get message ids from node
-func (f FetchConfig) GetMessagesIDS() ([]ID, error) {
-	var ids []ID
-
-	var getURI string
-	getEchoes := strings.Join(f.Echoes, "/")
+// MSG ...
+type MSG struct {
+	Message string `json:"message"`
+	ID      string `json:"id"`
+}
 
-	// Make strings
-	offset := strconv.Itoa(f.Offset)
-	limit := strconv.Itoa(f.Limit)
+// String makes u/m bundle line id:base64
+func (m MSG) String() string {
+	return m.ID + ":" + m.Message
+}
 
-	getURI = strings.Join([]string{f.Node, echoSchema, getEchoes, "/", offset, ":", limit}, "")
+// Storage IDEC messages storage served by a node
+type Storage interface {
+	// Echoes returns sorted names of stored echoes
+	Echoes() ([]string, error)
+	// IDs returns echo message ids using u/e offset:limit slice,
+	// see SliceIDs. 0:-1 is the whole index.
+	IDs(echo string, offset, limit int) ([]string, error)
+	// Count returns echo messages count
+	Count(echo string) (int, error)
+	// Get returns message. Returns ErrNotFound for missing one.
+	Get(id string) (MSG, error)
+	// Put stores base64 bundled message.
+	// Already stored message ids are ignored.
+	Put(m MSG) error
+}
 
-	// Get messages ids
-	response, err := http.Get(getURI)
-	if err != nil {
-		return ids, err
+// SliceIDs applies u/e offset:limit slice to echo index.
+// Negative offset counts from the index end, e.g. -10:10 is the last ten ids.
+// Negative limit slices to the index end.
+// Slice is clamped to the index bounds.
+func SliceIDs(ids []string, offset, limit int) []string {
+	if offset < 0 {
+		offset += len(ids)
+		if offset < 0 {
+			// Limit counts from the requested offset
+			if limit >= 0 {
+				limit += offset
+				if limit < 0 {
+					limit = 0
+				}
+			}
+			offset = 0
+		}
 	}
-
-	defer response.Body.Close()
-	c, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		return ids, err
+	if offset > len(ids) {
+		return nil
 	}
-
-	var i ID
-	var curEcho string
-	rawIDS := strings.Split(string(c), "\n")
-	for _, line := range rawIDS {
-
-		// Match echoarea
-		if strings.Contains(line, ".") {
-			curEcho = line
-			continue
-		}
-
-		// Match message ID
-		if !strings.Contains(line, ".") && !strings.Contains(line, ":") && line != "" {
-			i.Echo = curEcho
-			i.MsgID = line
-			ids = append(ids, i)
-		}
+	end := len(ids)
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
 	}
-
-	return ids, nil
+	return ids[offset:end]
 }
 
-// GetAllMessagesIDS get all message ids from node
-func (f FetchConfig) GetAllMessagesIDS() ([]ID, error) {
-	var ids []ID
-
-	var getURI string
-	getEchoes := strings.Join(f.Echoes, "/")
-
-	getURI = strings.Join([]string{f.Node, echoSchema, getEchoes}, "")
-
-	// Get messages ids
-	response, err := http.Get(getURI)
-	if err != nil {
-		return ids, err
+// ParseSlice parse u/e offset:limit slice.
+// Returns ok false if s is not a slice.
+func ParseSlice(s string) (offset, limit int, ok bool) {
+	o, l, found := strings.Cut(s, ":")
+	if !found {
+		return 0, 0, false
 	}
-
-	defer response.Body.Close()
-	c, err := ioutil.ReadAll(response.Body)
+	offset, err := strconv.Atoi(o)
 	if err != nil {
-		return ids, err
+		return 0, 0, false
 	}
-
-	var i ID
-	var curEcho string
-	rawIDS := strings.Split(string(c), "\n")
-	for _, line := range rawIDS {
-
-		// Match echoarea
-		if strings.Contains(line, ".") {
-			curEcho = line
-			continue
-		}
-
-		// Match message ID
-		if !strings.Contains(line, ".") && !strings.Contains(line, ":") && line != "" {
-			i.Echo = curEcho
-			i.MsgID = line
-			ids = append(ids, i)
-		}
+	limit, err = strconv.Atoi(l)
+	if err != nil {
+		return 0, 0, false
 	}
-
-	return ids, nil
+	return offset, limit, true
 }
 
-// MSG ...
-type MSG struct {
-	Message string `json:"message"`
-	ID      string `json:"id"`
-}
-
-// GetRawMessages get messages from node
-func (f FetchConfig) GetRawMessages(ids []ID) ([]MSG, error) {
-	var messages []MSG
-
-	var messagesIDS []string
-	for _, id := range ids {
-		messagesIDS = append(messagesIDS, id.MsgID)
-	}
-	getMessages := strings.Join(messagesIDS, "/")
-
-	getURI := strings.Join([]string{f.Node, messageSchema, getMessages}, "")
+// Blacklist set of blacklisted message ids
+type Blacklist map[string]struct{}
 
-	// Get messages ids
-	response, err := http.Get(getURI)
-	if err != nil {
-		e := errors.New(strings.Join([]string{"Failed to get", getURI, "."}, " "))
-		return messages, e
-	}
+// Contains reports whether message id is blacklisted
+func (b Blacklist) Contains(msgid string) bool {
+	_, ok := b[msgid]
+	return ok
+}
 
-	defer response.Body.Close()
-	c, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		return messages, err
+// Filter returns ids without blacklisted ones
+func (b Blacklist) Filter(ids []ID) []ID {
+	if len(b) == 0 {
+		return ids
 	}
-
-	for _, m := range strings.Split(string(c), "\n") {
-		if len(m) == 0 {
-			break
-		}
-		message := strings.Split(m, ":")
-		if len(message) > 1 {
-			messages = append(messages, MSG{message[1], message[0]})
+	var filtered []ID
+	for _, id := range ids {
+		if !b.Contains(id.MsgID) {
+			filtered = append(filtered, id)
 		}
 	}
-
-	return messages, err
+	return filtered
 }
 
 // Echo echo description
@@ -196,66 +165,57 @@ type Echo struct {
 	Description string `json:"description"`
 }
 
-// GetEchoList ...
-func (f FetchConfig) GetEchoList() ([]Echo, error) {
-	var echoes []Echo
-
-	// Check node features support
-	fres, err := http.Get(strings.Join([]string{strings.TrimRight(f.Node, "/"), features}, "/"))
-	if err != nil {
-		return echoes, err
-	}
-	defer fres.Body.Close()
+// nodeFeatures x/features of FetchConfig nodes by node address
+var nodeFeatures sync.Map
+
+// Client makes Client for FetchConfig node, used by all
+// FetchConfig and MultiFetcher calls. httpClient may be nil.
+// Node x/features are fetched once and shared by these Clients.
+func (f FetchConfig) Client(httpClient *http.Client) *Client {
+	retry := DefaultRetryPolicy
+	if f.Retry != nil {
+		retry = *f.Retry
+	}
+	c := NewClient(f.Node, httpClient)
+	c.Blacklist = f.Blacklist
+	c.Retry = &retry
+	c.Verify = f.Verify
+	c.Dates = f.Dates
+	c.shared = &nodeFeatures
+	return c
+}
 
-	c, err := ioutil.ReadAll(fres.Body)
-	if err != nil {
-		return echoes, err
-	}
+// GetMessagesIDS get message ids from node
+func (f FetchConfig) GetMessagesIDS() ([]ID, error) {
+	return f.Client(nil).GetMessagesIDS(context.Background(), f.Echoes, f.Offset, f.Limit)
+}
 
-	if !strings.Contains(string(c), listTXT) {
-		err = errors.New("Node does not support echoes list")
-		return echoes, err
-	}
+// GetAllMessagesIDS get all message ids from node
+func (f FetchConfig) GetAllMessagesIDS() ([]ID, error) {
+	return f.Client(nil).GetAllMessagesIDS(context.Background(), f.Echoes)
+}
 
-	lres, err := http.Get(strings.Join([]string{strings.TrimRight(f.Node, "/"), listTXT}, "/"))
-	if err != nil {
-		return echoes, err
-	}
-	defer lres.Body.Close()
+// GetRawMessages get messages from node
+func (f FetchConfig) GetRawMessages(ids []ID) ([]MSG, error) {
+	return f.Client(nil).GetRawMessages(context.Background(), ids)
+}
 
-	l, err := ioutil.ReadAll(lres.Body)
-	if err != nil {
-		return echoes, err
-	}
+// GetEchoList ...
+func (f FetchConfig) GetEchoList() ([]Echo, error) {
+	return f.Client(nil).GetEchoList(context.Background())
+}
 
-	echoes, err = ParseEchoList(string(l))
+// GetEchoCounts ...
+func (f FetchConfig) GetEchoCounts() (map[string]int, error) {
+	return f.Client(nil).GetEchoCounts(context.Background(), f.Echoes)
+}
 
-	return echoes, err
+// GetBlacklist ...
+func (f FetchConfig) GetBlacklist() (Blacklist, error) {
+	return f.Client(nil).GetBlacklist(context.Background())
 }
 
 // PostMessage sends prepared base64 point message to the node
 func (f FetchConfig) PostMessage(authstring, message string) error {
-	url := strings.TrimRight(f.Node, "/") + "/u/point"
-
-	data := fmt.Sprintf("pauth=%s&tmsg=%s", authstring, message)
-	req, err := http.NewRequest("POST", url, strings.NewReader(data))
-	if err != nil {
-		return err
-	}
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
-	}
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-
-	if !strings.Contains(string(body), "msg ok") {
-		return fmt.Errorf("Error from node: %s", string(body))
-	}
-	return nil
+	return f.Client(nil).PostMessage(context.Background(), authstring, message)
 }
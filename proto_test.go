@@ -1,7 +1,9 @@
 package idec
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 	"testing"
 
 	"gopkg.in/jarcoal/httpmock.v1"
@@ -111,6 +113,7 @@ file.wishes:10:Поиск файлов`)
 		return resp, nil
 	})
 
+	features := httpmock.GetCallCountInfo()["GET http://localhost/idec/x/features"]
 	echoes, err := fc.GetEchoList()
 	if err != nil {
 		t.Error(err)
@@ -118,15 +121,23 @@ file.wishes:10:Поиск файлов`)
 	if len(echoes) == 0 {
 		t.Error("Wrong echoes list")
 	}
+	// x/features is requested once per node
+	if _, err := fc.GetEchoList(); err != nil {
+		t.Error(err)
+	}
+	if n := httpmock.GetCallCountInfo()["GET http://localhost/idec/x/features"] - features; n > 1 {
+		t.Errorf("x/features requested %d times", n)
+	}
 
-	httpmock.RegisterResponder("GET", "http://localhost/idec/x/features", func(req *http.Request) (*http.Response, error) {
+	fc.Node = "http://localhost/old/"
+	httpmock.RegisterResponder("GET", "http://localhost/old/x/features", func(req *http.Request) (*http.Response, error) {
 		resp := httpmock.NewStringResponse(200, `u/e
 u/m
-x/c`)
+x/c/`)
 		return resp, nil
 	})
 	_, err = fc.GetEchoList()
-	if err == nil {
+	if !errors.Is(err, ErrNotSupported) {
 		t.Error(err)
 	}
 }
@@ -156,7 +167,46 @@ func TestPostMessage(t *testing.T) {
 	})
 
 	err = fc.PostMessage("auth", message)
-	if err == nil {
+	var nerr *NodeError
+	if !errors.As(err, &nerr) || nerr.StatusCode != 403 || nerr.Body != "error: wrong authstring" {
 		t.Error("Errors not precessed")
 	}
 }
+
+func TestSliceIDs(t *testing.T) {
+	ids := []string{"1", "2", "3", "4", "5"}
+	tests := []struct {
+		offset, limit int
+		want          string
+	}{
+		{0, 2, "12"},
+		{3, 10, "45"},
+		{5, 1, ""},
+		{7, 1, ""},
+		{-2, 2, "45"},
+		{-2, 1, "4"},
+		{-5, 5, "12345"},
+		{-7, 3, "1"},
+		{-7, 1, ""},
+		{0, 0, ""},
+		{1, -1, "2345"},
+		{-7, -1, "12345"},
+	}
+	for _, test := range tests {
+		got := strings.Join(SliceIDs(ids, test.offset, test.limit), "")
+		if got != test.want {
+			t.Errorf("%d:%d: %q, want %q", test.offset, test.limit, got, test.want)
+		}
+	}
+}
+
+func TestParseSlice(t *testing.T) {
+	if offset, limit, ok := ParseSlice("-10:5"); !ok || offset != -10 || limit != 5 {
+		t.Errorf("Wrong slice: %d:%d %v", offset, limit, ok)
+	}
+	for _, s := range []string{"ii.test.14", "1", "a:1", "1:b"} {
+		if _, _, ok := ParseSlice(s); ok {
+			t.Errorf("%q parsed as slice", s)
+		}
+	}
+}
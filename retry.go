@@ -0,0 +1,112 @@
+package idec
+
+// Node requests retry policy
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy node requests retry settings
+type RetryPolicy struct {
+	// MaxAttempts including the first one
+	MaxAttempts int
+	// BaseDelay before the first retry, doubled on each next one
+	BaseDelay time.Duration
+	// MaxDelay caps backoff and Retry-After delays. Zero disables cap.
+	MaxDelay time.Duration
+	// Jitter randomizes delay by given fraction, 0.2 is ±20%
+	Jitter float64
+	// RetryStatus HTTP status codes worth retrying
+	RetryStatus []int
+}
+
+// DefaultRetryPolicy retries transient node failures three times
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+	Jitter:      0.2,
+	RetryStatus: []int{
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// attempts returns total attempts count
+func (p *RetryPolicy) attempts() int {
+	if p == nil || p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// retryable checks response status
+func (p *RetryPolicy) retryable(status int) bool {
+	if p == nil {
+		return false
+	}
+	for _, s := range p.RetryStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns delay before retry number n starting from 1
+func (p *RetryPolicy) backoff(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	d = p.cap(d)
+	if p.Jitter > 0 {
+		d = time.Duration(float64(d) * (1 - p.Jitter + 2*p.Jitter*rand.Float64()))
+	}
+	return d
+}
+
+// cap limits delay by MaxDelay
+func (p *RetryPolicy) cap(d time.Duration) time.Duration {
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		return p.MaxDelay
+	}
+	return d
+}
+
+// retryAfter parses Retry-After header in seconds or HTTP date
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	h := resp.Header.Get("Retry-After")
+	if h == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(h); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleep waits for delay or context cancellation
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,125 @@
+package idec
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+var errTestConnection = errors.New("connection reset")
+
+func TestRetryBackoff(t *testing.T) {
+	p := &RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	for n, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if d := p.backoff(n + 1); d != want {
+			t.Errorf("Retry %d: delay %s, want %s", n+1, d, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.backoff(2); d < time.Second || d > 3*time.Second {
+			t.Fatalf("Delay %s out of jitter range", d)
+		}
+	}
+
+	// No policy
+	var nop *RetryPolicy
+	if nop.attempts() != 1 || nop.retryable(502) {
+		t.Error("Nil policy retries")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2019, 3, 4, 12, 0, 0, 0, time.UTC)
+	resp := &http.Response{Header: http.Header{}}
+	if _, ok := retryAfter(resp, now); ok {
+		t.Error("Missing Retry-After parsed")
+	}
+	resp.Header.Set("Retry-After", "7")
+	if d, ok := retryAfter(resp, now); !ok || d != 7*time.Second {
+		t.Errorf("Wrong Retry-After seconds: %s", d)
+	}
+	resp.Header.Set("Retry-After", now.Add(time.Minute).Format(http.TimeFormat))
+	if d, ok := retryAfter(resp, now); !ok || d != time.Minute {
+		t.Errorf("Wrong Retry-After date: %s", d)
+	}
+}
+
+func TestClientRetry(t *testing.T) {
+	c, mock := newMockClient()
+	c.Retry = &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, RetryStatus: []int{502, 503}}
+
+	// Transient failures
+	calls := 0
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/hXzRNEzmMuzKkT1HCxUb", func(req *http.Request) (*http.Response, error) {
+		calls++
+		switch calls {
+		case 1:
+			return httpmock.NewStringResponse(502, "Bad Gateway"), nil
+		case 2:
+			resp := httpmock.NewStringResponse(503, "Service Unavailable")
+			resp.Header.Set("Retry-After", "0")
+			return resp, nil
+		}
+		return httpmock.NewStringResponse(200, "hXzRNEzmMuzKkT1HCxUb:YQ==\n"), nil
+	})
+	msgs, err := c.GetRawMessages(context.Background(), []ID{{"ii.test.14", "hXzRNEzmMuzKkT1HCxUb"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || calls != 3 {
+		t.Errorf("Wrong retries: %d calls, %v", calls, msgs)
+	}
+
+	// Not retryable status
+	calls = 0
+	mock.RegisterResponder("GET", "http://localhost/idec/u/e/ii.test.14", func(req *http.Request) (*http.Response, error) {
+		calls++
+		return httpmock.NewStringResponse(404, "Not Found"), nil
+	})
+	if _, err := c.GetAllMessagesIDS(context.Background(), []string{"ii.test.14"}); err == nil || calls != 1 {
+		t.Errorf("Wrong not retryable status processing: %d calls, %v", calls, err)
+	}
+
+	// Connection errors are wrapped
+	calls = 0
+	mock.RegisterResponder("GET", "http://localhost/idec/u/e/ii.test.14", func(req *http.Request) (*http.Response, error) {
+		calls++
+		return nil, errTestConnection
+	})
+	_, err = c.GetAllMessagesIDS(context.Background(), []string{"ii.test.14"})
+	if !errors.Is(err, errTestConnection) || calls != 3 {
+		t.Errorf("Wrong connection error processing: %d calls, %v", calls, err)
+	}
+}
+
+func TestClientPostNoRetry(t *testing.T) {
+	c, mock := newMockClient()
+	c.Retry = &RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, RetryStatus: []int{502}}
+
+	calls := 0
+	mock.RegisterResponder("POST", "http://localhost/idec/u/point", func(req *http.Request) (*http.Response, error) {
+		calls++
+		return httpmock.NewStringResponse(502, "Bad Gateway"), nil
+	})
+	var nodeErr *NodeError
+	if err := c.PostMessage(context.Background(), "auth", "message"); !errors.As(err, &nodeErr) {
+		t.Errorf("Wrong post error: %v", err)
+	}
+
+	mock.RegisterResponder("POST", "http://localhost/idec/u/point", func(req *http.Request) (*http.Response, error) {
+		calls++
+		return nil, errTestConnection
+	})
+	if err := c.PostMessage(context.Background(), "auth", "message"); !errors.Is(err, errTestConnection) {
+		t.Errorf("Wrong post error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("Post is retried: %d calls", calls)
+	}
+}
@@ -0,0 +1,317 @@
+// Package server implements IDEC node HTTP protocol
+// on top of pluggable message storage.
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	idec "github.com/idec-net/go-idec"
+)
+
+// Storage node messages storage, see idec.Storage
+type Storage = idec.Storage
+
+// Features served by Handler
+var Features = []string{
+	idec.FeatureListTXT,
+	idec.FeatureBlacklistTXT,
+	idec.FeatureUEcho,
+	idec.FeatureXCount,
+}
+
+// Handler IDEC node http.Handler serving u/e, u/m, u/point,
+// list.txt, blacklist.txt, x/features and x/c at its root.
+// Use http.StripPrefix to serve node under a path.
+type Handler struct {
+	Storage Storage
+	// Auth returns point name and number for authstring.
+	// Posting is disabled if nil.
+	Auth func(pauth string) (name string, point int, ok bool)
+	// Station node name used in posted messages addresses
+	Station string
+	// Clock dates posted messages, time.Now if nil
+	Clock idec.Clock
+	// Blacklist message ids hidden from u/e and u/m
+	Blacklist idec.Blacklist
+	// Descriptions list.txt echo descriptions
+	Descriptions map[string]string
+	// ErrorLog receives storage errors. log.Print if nil.
+	ErrorLog func(error)
+}
+
+// NewHandler makes Handler serving storage
+func NewHandler(storage Storage, station string) *Handler {
+	return &Handler{Storage: storage, Station: station}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "u/point" || strings.HasPrefix(path, "u/point/") {
+		h.point(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var err error
+	switch {
+	case strings.HasPrefix(path, "u/e/"):
+		err = h.index(w, split(strings.TrimPrefix(path, "u/e/")))
+	case strings.HasPrefix(path, "u/m/"):
+		err = h.messages(w, split(strings.TrimPrefix(path, "u/m/")))
+	case strings.HasPrefix(path, "x/c/"):
+		err = h.counts(w, split(strings.TrimPrefix(path, "x/c/")))
+	case path == "list.txt":
+		err = h.list(w)
+	case path == "blacklist.txt":
+		h.blacklist(w)
+	case path == "x/features":
+		write(w, Features)
+	default:
+		http.NotFound(w, r)
+	}
+
+	if err != nil {
+		h.error(w, err)
+	}
+}
+
+// split path segments skipping empty ones
+func split(path string) []string {
+	var s []string
+	for _, p := range strings.Split(path, "/") {
+		if p != "" {
+			s = append(s, p)
+		}
+	}
+	return s
+}
+
+// write lines
+func write(w http.ResponseWriter, lines []string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, line := range lines {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// badRequest is reported to client as is
+type badRequest struct {
+	err error
+}
+
+func (e *badRequest) Error() string {
+	return e.err.Error()
+}
+
+// error reports request error
+func (h *Handler) error(w http.ResponseWriter, err error) {
+	var bad *badRequest
+	if errors.As(err, &bad) {
+		http.Error(w, bad.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if h.ErrorLog != nil {
+		h.ErrorLog(err)
+	} else {
+		log.Print(err)
+	}
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// echoes validates echo names
+func echoes(names []string) error {
+	for _, name := range names {
+		if _, err := idec.ParseEchoName(name); err != nil {
+			return &badRequest{err}
+		}
+	}
+	return nil
+}
+
+// index serves u/e/echo/.../offset:limit
+func (h *Handler) index(w http.ResponseWriter, args []string) error {
+	offset, limit := 0, -1
+	if len(args) > 0 {
+		if o, l, ok := idec.ParseSlice(args[len(args)-1]); ok {
+			offset, limit = o, l
+			args = args[:len(args)-1]
+		}
+	}
+	if err := echoes(args); err != nil {
+		return err
+	}
+
+	var lines []string
+	for _, echo := range args {
+		ids, err := h.ids(echo, offset, limit)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, echo)
+		lines = append(lines, ids...)
+	}
+	write(w, lines)
+	return nil
+}
+
+// ids returns echo index slice without blacklisted ids,
+// so slices and counts agree for clients
+func (h *Handler) ids(echo string, offset, limit int) ([]string, error) {
+	if len(h.Blacklist) == 0 {
+		return h.Storage.IDs(echo, offset, limit)
+	}
+
+	all, err := h.Storage.IDs(echo, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, id := range all {
+		if !h.Blacklist.Contains(id) {
+			ids = append(ids, id)
+		}
+	}
+	return idec.SliceIDs(ids, offset, limit), nil
+}
+
+// count returns echo messages count without blacklisted ones
+func (h *Handler) count(echo string) (int, error) {
+	if len(h.Blacklist) == 0 {
+		return h.Storage.Count(echo)
+	}
+	ids, err := h.ids(echo, 0, -1)
+	return len(ids), err
+}
+
+// messages serves u/m/id/..., missing messages are skipped
+func (h *Handler) messages(w http.ResponseWriter, ids []string) error {
+	var lines []string
+	for _, id := range ids {
+		if h.Blacklist.Contains(id) {
+			continue
+		}
+		m, err := h.Storage.Get(id)
+		if errors.Is(err, idec.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		lines = append(lines, m.String())
+	}
+	write(w, lines)
+	return nil
+}
+
+// counts serves x/c/echo/...
+func (h *Handler) counts(w http.ResponseWriter, args []string) error {
+	if err := echoes(args); err != nil {
+		return err
+	}
+
+	var lines []string
+	for _, echo := range args {
+		n, err := h.count(echo)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("%s:%d", echo, n))
+	}
+	write(w, lines)
+	return nil
+}
+
+// list serves list.txt
+func (h *Handler) list(w http.ResponseWriter) error {
+	names, err := h.Storage.Echoes()
+	if err != nil {
+		return err
+	}
+
+	var lines []string
+	for _, echo := range names {
+		n, err := h.count(echo)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, fmt.Sprintf("%s:%d:%s", echo, n, h.Descriptions[echo]))
+	}
+	write(w, lines)
+	return nil
+}
+
+// blacklist serves blacklist.txt
+func (h *Handler) blacklist(w http.ResponseWriter) {
+	var ids []string
+	for id := range h.Blacklist {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	write(w, ids)
+}
+
+// point serves u/point POST pauth and tmsg form
+// and GET u/point/pauth/tmsg
+func (h *Handler) point(w http.ResponseWriter, r *http.Request) {
+	var pauth, tmsg string
+	switch r.Method {
+	case http.MethodPost:
+		pauth, tmsg = r.PostFormValue("pauth"), r.PostFormValue("tmsg")
+	case http.MethodGet:
+		// Standard base64 message may end with slash,
+		// so it is taken from the escaped path as is
+		_, args, _ := strings.Cut(r.URL.EscapedPath(), "u/point/")
+		pauth, tmsg, _ = strings.Cut(args, "/")
+		var err error
+		if pauth, err = url.PathUnescape(pauth); err == nil {
+			tmsg, err = url.PathUnescape(tmsg)
+		}
+		if err != nil {
+			http.Error(w, "msg error: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if h.Auth == nil {
+		http.Error(w, "no auth", http.StatusForbidden)
+		return
+	}
+	name, point, ok := h.Auth(pauth)
+	if !ok {
+		http.Error(w, "no auth", http.StatusForbidden)
+		return
+	}
+
+	// Form values are unescaped already, keep '+' intact
+	p, err := idec.ParsePointMessage(url.QueryEscape(tmsg))
+	if err != nil {
+		http.Error(w, "msg error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	address := idec.Address{Station: h.Station, Point: point}
+	msg, line, err := idec.Finalize(p, name, address.String(), h.Clock)
+	if err != nil {
+		http.Error(w, "msg error: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	id, bundle, _ := strings.Cut(line, ":")
+	if err := h.Storage.Put(idec.MSG{Message: bundle, ID: id}); err != nil {
+		h.error(w, err)
+		return
+	}
+	write(w, []string{"msg ok:" + msg.ID})
+}
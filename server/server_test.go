@@ -0,0 +1,281 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	idec "github.com/idec-net/go-idec"
+)
+
+// memStorage minimal Storage for handler tests
+type memStorage struct {
+	msgs  map[string]idec.MSG
+	index map[string][]string
+}
+
+func newMemStorage() *memStorage {
+	return &memStorage{make(map[string]idec.MSG), make(map[string][]string)}
+}
+
+func (s *memStorage) Echoes() ([]string, error) {
+	var echoes []string
+	for echo := range s.index {
+		echoes = append(echoes, echo)
+	}
+	return echoes, nil
+}
+
+func (s *memStorage) IDs(echo string, offset, limit int) ([]string, error) {
+	return idec.SliceIDs(s.index[echo], offset, limit), nil
+}
+
+func (s *memStorage) Count(echo string) (int, error) {
+	return len(s.index[echo]), nil
+}
+
+func (s *memStorage) Get(id string) (idec.MSG, error) {
+	m, ok := s.msgs[id]
+	if !ok {
+		return idec.MSG{}, idec.ErrNotFound
+	}
+	return m, nil
+}
+
+func (s *memStorage) Put(m idec.MSG) error {
+	msg, err := idec.ParseMessage(m.Message)
+	if err != nil {
+		return err
+	}
+	s.msgs[m.ID] = m
+	s.index[msg.Echo] = append(s.index[msg.Echo], m.ID)
+	return nil
+}
+
+func newTestNode(t *testing.T) (*Handler, *idec.Client) {
+	h := NewHandler(newMemStorage(), "node")
+	h.Auth = func(pauth string) (string, int, bool) {
+		return "Difrex", 1, pauth == "secret"
+	}
+	h.Clock = func() time.Time { return time.Unix(1551689766, 0) }
+	h.Descriptions = map[string]string{"ii.test.14": "Test echo"}
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return h, idec.NewClient(srv.URL, srv.Client())
+}
+
+func TestHandler(t *testing.T) {
+	h, c := newTestNode(t)
+	ctx := context.Background()
+
+	for _, body := range []string{"Hello\nworld", "Second\nmessage", "Third\nmessage"} {
+		p := &idec.PointMessage{Echo: "ii.test.14", To: "All", Subg: "test", Body: body}
+		if err := c.PostMessage(ctx, "secret", p.PrepareMessageForSend()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids, err := c.GetAllMessagesIDS(ctx, []string{"ii.test.14", "ii.empty"})
+	if err != nil || len(ids) != 3 {
+		t.Fatalf("Wrong index: %v %v", ids, err)
+	}
+	tail, err := c.GetMessagesIDS(ctx, []string{"ii.test.14"}, -2, 1)
+	if err != nil || len(tail) != 1 || tail[0] != ids[1] {
+		t.Errorf("Wrong index slice: %v %v", tail, err)
+	}
+
+	msgs, err := c.GetRawMessages(ctx, append(ids, idec.ID{Echo: "ii.test.14", MsgID: "AAAAAAAAAAAAAAAAAAAA"}))
+	if err != nil || len(msgs) != 3 {
+		t.Fatalf("Wrong messages: %v %v", msgs, err)
+	}
+	m, err := idec.ParseMessage(msgs[0].Message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.From != "Difrex" || m.Address != "node,1" || m.Timestamp != 1551689766 || m.Echo != "ii.test.14" {
+		t.Errorf("Wrong posted message: %+v", m)
+	}
+	if err := idec.VerifyMSG(msgs[0]); err != nil {
+		t.Error(err)
+	}
+
+	echoes, err := c.GetEchoList(ctx)
+	if err != nil || len(echoes) != 1 || echoes[0] != (idec.Echo{Name: "ii.test.14", Size: 3, Description: "Test echo"}) {
+		t.Errorf("Wrong list.txt: %v %v", echoes, err)
+	}
+	counts, err := c.GetEchoCounts(ctx, []string{"ii.test.14", "ii.empty"})
+	if err != nil || counts["ii.test.14"] != 3 || counts["ii.empty"] != 0 {
+		t.Errorf("Wrong x/c: %v %v", counts, err)
+	}
+
+	// Blacklisted messages are hidden
+	h.Blacklist = idec.Blacklist{ids[0].MsgID: {}}
+	blacklist, err := c.GetBlacklist(ctx)
+	if err != nil || !blacklist.Contains(ids[0].MsgID) {
+		t.Errorf("Wrong blacklist.txt: %v %v", blacklist, err)
+	}
+	c.Blacklist = nil
+	if ids, _ := c.GetAllMessagesIDS(ctx, []string{"ii.test.14"}); len(ids) != 2 {
+		t.Errorf("Blacklisted id is served: %v", ids)
+	}
+	if msgs, _ := c.GetRawMessages(ctx, ids[:1]); len(msgs) != 0 {
+		t.Errorf("Blacklisted message is served: %v", msgs)
+	}
+}
+
+func TestHandlerPoint(t *testing.T) {
+	h, c := newTestNode(t)
+	ctx := context.Background()
+	p := &idec.PointMessage{Echo: "ii.test.14", To: "All", Subg: "test", Body: "Тест ??? >>>\nmessage"}
+
+	var nodeErr *idec.NodeError
+	err := c.PostMessage(ctx, "wrong", p.PrepareMessageForSend())
+	if !errors.As(err, &nodeErr) || nodeErr.StatusCode != http.StatusForbidden {
+		t.Errorf("Wrong auth error: %v", err)
+	}
+	bad := &idec.PointMessage{Echo: "test", To: "All", Subg: "test", Body: "test\ntest"}
+	err = c.PostMessage(ctx, "secret", bad.PrepareMessageForSend())
+	if !errors.As(err, &nodeErr) || nodeErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Wrong message error: %v", err)
+	}
+
+	// GET with URL-safe message
+	message := p.PrepareMessageForSendVariant(idec.Base64URL)
+	resp, err := http.Get(strings.TrimSuffix(c.Node, "/") + "/u/point/secret/" + message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Wrong GET u/point status: %d", resp.StatusCode)
+	}
+	if n, _ := h.Storage.Count("ii.test.14"); n != 1 {
+		t.Errorf("Message is not stored: %d", n)
+	}
+
+	// GET with standard base64 message ending with slash
+	slash := &idec.PointMessage{Echo: "ii.test.14", To: "All", Subg: "test", Body: "ok\nok?"}
+	message, _ = url.QueryUnescape(slash.PrepareMessageForSend())
+	if !strings.HasSuffix(message, "/") {
+		t.Fatalf("Message doesn't end with slash: %s", message)
+	}
+	resp, err = http.Get(strings.TrimSuffix(c.Node, "/") + "/u/point/secret/" + strings.ReplaceAll(message, "+", "%2B"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Wrong GET u/point status: %d", resp.StatusCode)
+	}
+	ids, _ := h.Storage.IDs("ii.test.14", 0, -1)
+	if len(ids) != 2 {
+		t.Fatalf("Message is not stored: %v", ids)
+	}
+	m, err := h.Storage.Get(ids[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := idec.ParseMessage(m.Message); err != nil || !strings.HasSuffix(msg.Body, "ok?") {
+		t.Errorf("Wrong stored message: %+v %v", msg, err)
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	_, c := newTestNode(t)
+	tests := []struct {
+		method, path string
+		status       int
+	}{
+		{http.MethodGet, "/u/e/ii.test.14/0:10", http.StatusOK},
+		{http.MethodGet, "/u/e/bad/0:10", http.StatusBadRequest},
+		{http.MethodGet, "/x/c/ii..test", http.StatusBadRequest},
+		{http.MethodPost, "/u/e/ii.test.14", http.StatusMethodNotAllowed},
+		{http.MethodDelete, "/u/point", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/x/unknown", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest(test.method, strings.TrimSuffix(c.Node, "/")+test.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("%s %s: %d, want %d", test.method, test.path, resp.StatusCode, test.status)
+		}
+	}
+
+	features, err := c.Features(context.Background())
+	if err != nil || !features.ListTXT || !features.BlacklistTXT || !features.XCount || !features.UEcho {
+		t.Errorf("Wrong x/features: %+v %v", features, err)
+	}
+}
+
+func TestHandlerBlacklistSync(t *testing.T) {
+	h := NewHandler(newMemStorage(), "node")
+	h.Auth = func(pauth string) (string, int, bool) {
+		return "Difrex", 1, true
+	}
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		h.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	c := idec.NewClient(srv.URL, srv.Client())
+	ctx := context.Background()
+
+	post := func(body string) {
+		p := &idec.PointMessage{Echo: "ii.test.14", To: "All", Subg: "test", Body: body + "\nmessage"}
+		if err := c.PostMessage(ctx, "secret", p.PrepareMessageForSend()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, body := range []string{"first", "second", "third", "fourth"} {
+		post(body)
+	}
+	ids, err := h.Storage.IDs("ii.test.14", 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Blacklist = idec.Blacklist{ids[1]: {}}
+
+	// Blacklisted ids are not counted
+	counts, err := c.GetEchoCounts(ctx, []string{"ii.test.14"})
+	if err != nil || counts["ii.test.14"] != 3 {
+		t.Errorf("Wrong x/c: %v %v", counts, err)
+	}
+	echoes, err := c.GetEchoList(ctx)
+	if err != nil || len(echoes) != 1 || echoes[0].Size != 3 {
+		t.Errorf("Wrong list.txt: %v %v", echoes, err)
+	}
+	tail, err := c.GetMessagesIDS(ctx, []string{"ii.test.14"}, -3, 1)
+	if err != nil || len(tail) != 1 || tail[0].MsgID != ids[0] {
+		t.Errorf("Wrong index slice: %v %v", tail, err)
+	}
+
+	s := idec.NewSyncer(nil)
+	msgs, err := s.Sync(ctx, c, []string{"ii.test.14"})
+	if err != nil || len(msgs) != 3 {
+		t.Fatalf("Wrong first sync: %d %v", len(msgs), err)
+	}
+
+	// Only the new tail is requested
+	post("fifth")
+	paths = nil
+	msgs, err = s.Sync(ctx, c, []string{"ii.test.14"})
+	if err != nil || len(msgs) != 1 || !strings.HasPrefix(msgs[0].Body, "\nfifth") {
+		t.Fatalf("Wrong second sync: %v %v", msgs, err)
+	}
+	for _, path := range paths {
+		if path == "/u/e/ii.test.14" {
+			t.Errorf("Full index is requested: %v", paths)
+		}
+	}
+}
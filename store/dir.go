@@ -0,0 +1,254 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	idec "github.com/idec-net/go-idec"
+)
+
+// Dir flat-file Store of classic ii-node data directory:
+// echo/<name> message ids one per line and msg/<id> plain messages
+type Dir struct {
+	// Root data directory
+	Root string
+
+	mu sync.RWMutex
+}
+
+// NewDir makes Dir store creating echo and msg directories in root
+func NewDir(root string) (*Dir, error) {
+	for _, dir := range []string{"echo", "msg"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &Dir{Root: root}, nil
+}
+
+func (s *Dir) echoPath(echo string) string {
+	return filepath.Join(s.Root, "echo", echo)
+}
+
+func (s *Dir) msgPath(id string) string {
+	return filepath.Join(s.Root, "msg", id)
+}
+
+// Put stores base64 bundled message as plain text
+// keeping its original bytes
+func (s *Dir) Put(m idec.MSG) error {
+	msg, err := parse(m)
+	if err != nil {
+		return err
+	}
+	plain, _, err := idec.DecodeBase64(m.Message)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Echo index is the source of truth, message file may be left over
+	ids, err := s.index(msg.Echo)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id == m.ID {
+			return nil
+		}
+	}
+	if err := writeFile(s.msgPath(m.ID), plain); err != nil {
+		return err
+	}
+	if err := s.appendIndex(msg.Echo, m.ID); err != nil {
+		os.Remove(s.msgPath(m.ID))
+		return err
+	}
+	return nil
+}
+
+// appendIndex appends message id to echo index file
+func (s *Dir) appendIndex(echo, id string) error {
+	f, err := os.OpenFile(s.echoPath(echo), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, id); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Get returns message
+func (s *Dir) Get(id string) (idec.MSG, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	plain, err := s.read(id)
+	if err != nil {
+		return idec.MSG{}, err
+	}
+	return idec.MSG{Message: base64.StdEncoding.EncodeToString(plain), ID: id}, nil
+}
+
+// read reads plain message file
+func (s *Dir) read(id string) ([]byte, error) {
+	if !idec.IsMsgID(id) {
+		return nil, idec.ErrNotFound
+	}
+	plain, err := ioutil.ReadFile(s.msgPath(id))
+	if os.IsNotExist(err) {
+		return nil, idec.ErrNotFound
+	}
+	return plain, err
+}
+
+// IDs returns echo message ids slice
+func (s *Dir) IDs(echo string, offset, limit int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids, err := s.index(echo)
+	if err != nil {
+		return nil, err
+	}
+	return idec.SliceIDs(ids, offset, limit), nil
+}
+
+// index reads echo index file, missing one is empty
+func (s *Dir) index(echo string) ([]string, error) {
+	if _, err := idec.ParseEchoName(echo); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(s.echoPath(echo))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if id := strings.TrimSpace(scanner.Text()); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids, scanner.Err()
+}
+
+// Count returns echo messages count
+func (s *Dir) Count(echo string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids, err := s.index(echo)
+	return len(ids), err
+}
+
+// Echoes returns sorted echo names of index files
+func (s *Dir) Echoes() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	files, err := ioutil.ReadDir(filepath.Join(s.Root, "echo"))
+	if err != nil {
+		return nil, err
+	}
+
+	var echoes []string
+	for _, f := range files {
+		if _, err := idec.ParseEchoName(f.Name()); err == nil && !f.IsDir() {
+			echoes = append(echoes, f.Name())
+		}
+	}
+	sort.Strings(echoes)
+	return echoes, nil
+}
+
+// Delete removes message file and its echo index line
+func (s *Dir) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	plain, err := s.read(id)
+	if err != nil {
+		return err
+	}
+	msg, err := idec.ParsePlainMessage(plain)
+	if err != nil {
+		return fmt.Errorf("message %s: %w", id, err)
+	}
+
+	ids, err := s.index(msg.Echo)
+	if err != nil {
+		return err
+	}
+	var index bytes.Buffer
+	for _, i := range ids {
+		if i != id {
+			fmt.Fprintln(&index, i)
+		}
+	}
+	if err := writeFile(s.echoPath(msg.Echo), index.Bytes()); err != nil {
+		return err
+	}
+	return os.Remove(s.msgPath(id))
+}
+
+// Each calls fn for every message, missing message files are skipped
+func (s *Dir) Each(fn func(idec.MSG) error) error {
+	echoes, err := s.Echoes()
+	if err != nil {
+		return err
+	}
+	for _, echo := range echoes {
+		ids, err := s.IDs(echo, 0, -1)
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			m, err := s.Get(id)
+			if errors.Is(err, idec.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if err := fn(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFile replaces file atomically
+func writeFile(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
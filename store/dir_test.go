@@ -0,0 +1,120 @@
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	idec "github.com/idec-net/go-idec"
+	"github.com/idec-net/go-idec/server"
+)
+
+func TestDir(t *testing.T) {
+	s, err := NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+}
+
+func TestDirLayout(t *testing.T) {
+	root := t.TempDir()
+	raw := "ii/ok\nii.test.14\n1551689766\nDifrex\ndynamic,1\nAll\ntest\n\ntest\n"
+	id := idec.MakeMsgID(raw)
+
+	// Existing ii-node data directory
+	for path, data := range map[string]string{
+		"echo/ii.test.14":  id + "\n",
+		"echo/.tmp-1":      "",
+		"msg/" + id:        raw,
+		"msg/unrelated.md": "",
+	} {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := NewDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := server.NewHandler(s, "node")
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	c := idec.NewClient(srv.URL, srv.Client())
+	c.Verify = idec.VerifyReject
+
+	ctx := context.Background()
+	echoes, err := c.GetEchoList(ctx)
+	if err != nil || len(echoes) != 1 || echoes[0].Name != "ii.test.14" || echoes[0].Size != 1 {
+		t.Errorf("Wrong echoes: %v %v", echoes, err)
+	}
+	ids, err := c.GetAllMessagesIDS(ctx, []string{"ii.test.14"})
+	if err != nil || len(ids) != 1 || ids[0].MsgID != id {
+		t.Fatalf("Wrong index: %v %v", ids, err)
+	}
+	msgs, err := c.GetRawMessages(ctx, ids)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("Wrong messages: %v %v", msgs, err)
+	}
+
+	// Messages are stored as plain text
+	m := testMSG(t, "pipe.2032", "\nПривет")
+	if err := s.Put(m); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := ioutil.ReadFile(filepath.Join(root, "msg", m.ID))
+	if err != nil || idec.MakeMsgID(string(plain)) != m.ID {
+		t.Errorf("Wrong message file: %q %v", plain, err)
+	}
+	index, err := ioutil.ReadFile(filepath.Join(root, "echo", "pipe.2032"))
+	if err != nil || string(index) != m.ID+"\n" {
+		t.Errorf("Wrong index file: %q %v", index, err)
+	}
+}
+
+// Message is not stored if its index append fails
+func TestDirPutIndexFailure(t *testing.T) {
+	root := t.TempDir()
+	s, err := NewDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Missing index that can't be created
+	index := filepath.Join(root, "echo", "ii.test.14")
+	if err := os.Symlink(filepath.Join(root, "missing", "ii.test.14"), index); err != nil {
+		t.Fatal(err)
+	}
+
+	m := testMSG(t, "ii.test.14", "\ntest")
+	if err := s.Put(m); err == nil {
+		t.Fatal("Index append failure is not reported")
+	}
+	if _, err := os.Stat(filepath.Join(root, "msg", m.ID)); !os.IsNotExist(err) {
+		t.Errorf("Unindexed message file is left: %v", err)
+	}
+
+	// Left over message file doesn't stop later puts
+	if err := os.Remove(index); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "msg", m.ID), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(m); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Count("ii.test.14"); err != nil || n != 1 {
+		t.Errorf("Message is not indexed: %d %v", n, err)
+	}
+	if got, err := s.Get(m.ID); err != nil || got != m {
+		t.Errorf("Wrong stored message: %v %v", got, err)
+	}
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"sort"
+	"sync"
+
+	idec "github.com/idec-net/go-idec"
+)
+
+// Memory in-memory Store, e.g. for tests
+type Memory struct {
+	mu    sync.RWMutex
+	msgs  map[string]memoryMSG
+	index map[string][]string
+}
+
+// memoryMSG stored message with its echo
+type memoryMSG struct {
+	idec.MSG
+	echo string
+}
+
+// NewMemory makes empty Memory store
+func NewMemory() *Memory {
+	return &Memory{
+		msgs:  make(map[string]memoryMSG),
+		index: make(map[string][]string),
+	}
+}
+
+// Put stores base64 bundled message
+func (s *Memory) Put(m idec.MSG) error {
+	msg, err := parse(m)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.msgs[m.ID]; ok {
+		return nil
+	}
+	s.msgs[m.ID] = memoryMSG{m, msg.Echo}
+	s.index[msg.Echo] = append(s.index[msg.Echo], m.ID)
+	return nil
+}
+
+// Get returns message
+func (s *Memory) Get(id string) (idec.MSG, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.msgs[id]
+	if !ok {
+		return idec.MSG{}, idec.ErrNotFound
+	}
+	return m.MSG, nil
+}
+
+// IDs returns echo message ids slice
+func (s *Memory) IDs(echo string, offset, limit int) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ids := idec.SliceIDs(s.index[echo], offset, limit)
+	// Index is appended in place
+	return append([]string(nil), ids...), nil
+}
+
+// Count returns echo messages count
+func (s *Memory) Count(echo string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.index[echo]), nil
+}
+
+// Echoes returns sorted echo names
+func (s *Memory) Echoes() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var echoes []string
+	for echo := range s.index {
+		echoes = append(echoes, echo)
+	}
+	sort.Strings(echoes)
+	return echoes, nil
+}
+
+// Delete removes message
+func (s *Memory) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.msgs[id]
+	if !ok {
+		return idec.ErrNotFound
+	}
+	delete(s.msgs, id)
+
+	ids := s.index[m.echo]
+	for i := range ids {
+		if ids[i] == id {
+			ids = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+	if len(ids) == 0 {
+		delete(s.index, m.echo)
+	} else {
+		s.index[m.echo] = ids
+	}
+	return nil
+}
+
+// Each calls fn for every message
+func (s *Memory) Each(fn func(idec.MSG) error) error {
+	echoes, _ := s.Echoes()
+	for _, echo := range echoes {
+		ids, _ := s.IDs(echo, 0, -1)
+		for _, id := range ids {
+			m, err := s.Get(id)
+			if err != nil {
+				// Deleted meanwhile
+				continue
+			}
+			if err := fn(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+// Package store persists IDEC messages.
+// Store extends idec.Storage, so stores can be served by a node.
+package store
+
+import (
+	"fmt"
+
+	idec "github.com/idec-net/go-idec"
+)
+
+// Store IDEC messages storage.
+// Put, Get, IDs, Count and Echoes are documented in idec.Storage.
+type Store interface {
+	idec.Storage
+	// Delete removes message. Returns idec.ErrNotFound for missing one.
+	Delete(id string) error
+	// Each calls fn for every message echo by echo in index order
+	Each(fn func(idec.MSG) error) error
+}
+
+// parse checks bundled message id and returns its echo name
+func parse(m idec.MSG) (idec.Message, error) {
+	if !idec.IsMsgID(m.ID) {
+		return idec.Message{}, fmt.Errorf("message %q: %w", m.ID, idec.ErrBadValue)
+	}
+	msg, err := idec.ParseMessage(m.Message)
+	if err != nil {
+		return idec.Message{}, fmt.Errorf("message %s: %w", m.ID, err)
+	}
+	if _, err := idec.ParseEchoName(msg.Echo); err != nil {
+		return idec.Message{}, fmt.Errorf("message %s: %w", m.ID, err)
+	}
+	return msg, nil
+}
@@ -0,0 +1,103 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+
+	idec "github.com/idec-net/go-idec"
+)
+
+var (
+	_ Store = (*Memory)(nil)
+	_ Store = (*Dir)(nil)
+)
+
+// testMSG makes bundled message of echo
+func testMSG(t *testing.T, echo, body string) idec.MSG {
+	m := idec.Message{
+		Tags:      idec.NewTags("ok", ""),
+		Echo:      echo,
+		Timestamp: 1551689766,
+		From:      "Difrex",
+		Address:   "dynamic,1",
+		To:        "All",
+		Subg:      "test",
+		Body:      body,
+	}
+	raw, err := m.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return idec.MSG{Message: base64.StdEncoding.EncodeToString([]byte(raw)), ID: idec.MakeMsgID(raw)}
+}
+
+// testStore checks Store behaviour
+func testStore(t *testing.T, s Store) {
+	first := testMSG(t, "ii.test.14", "first")
+	second := testMSG(t, "ii.test.14", "second")
+	third := testMSG(t, "ii.test.14", "third")
+	other := testMSG(t, "pipe.2032", "other")
+	for _, m := range []idec.MSG{first, second, other, third, first} {
+		if err := s.Put(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Put(idec.MSG{Message: first.Message, ID: "../../etc/passwd"}); !errors.Is(err, idec.ErrBadValue) {
+		t.Errorf("Bad id is stored: %v", err)
+	}
+	if err := s.Put(idec.MSG{Message: "Bla*Bla", ID: "AAAAAAAAAAAAAAAAAAAA"}); !errors.Is(err, idec.ErrBadBase64) {
+		t.Errorf("Bad message is stored: %v", err)
+	}
+
+	m, err := s.Get(second.ID)
+	if err != nil || m != second {
+		t.Errorf("Wrong message: %v %v", m, err)
+	}
+	if _, err := s.Get("AAAAAAAAAAAAAAAAAAAA"); !errors.Is(err, idec.ErrNotFound) {
+		t.Errorf("Wrong missing message error: %v", err)
+	}
+
+	echoes, err := s.Echoes()
+	if err != nil || !reflect.DeepEqual(echoes, []string{"ii.test.14", "pipe.2032"}) {
+		t.Errorf("Wrong echoes: %v %v", echoes, err)
+	}
+	ids, err := s.IDs("ii.test.14", 0, -1)
+	if err != nil || !reflect.DeepEqual(ids, []string{first.ID, second.ID, third.ID}) {
+		t.Errorf("Wrong index: %v %v", ids, err)
+	}
+	ids, err = s.IDs("ii.test.14", -2, 1)
+	if err != nil || !reflect.DeepEqual(ids, []string{second.ID}) {
+		t.Errorf("Wrong index slice: %v %v", ids, err)
+	}
+	if n, err := s.Count("ii.test.14"); err != nil || n != 3 {
+		t.Errorf("Wrong count: %d %v", n, err)
+	}
+	if n, err := s.Count("ii.empty"); err != nil || n != 0 {
+		t.Errorf("Wrong empty echo count: %d %v", n, err)
+	}
+
+	if err := s.Delete(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete(second.ID); !errors.Is(err, idec.ErrNotFound) {
+		t.Errorf("Wrong missing message delete error: %v", err)
+	}
+	if _, err := s.Get(second.ID); !errors.Is(err, idec.ErrNotFound) {
+		t.Errorf("Deleted message is stored: %v", err)
+	}
+
+	var each []idec.MSG
+	err = s.Each(func(m idec.MSG) error {
+		each = append(each, m)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(each, []idec.MSG{first, third, other}) {
+		t.Errorf("Wrong messages: %v %v", each, err)
+	}
+	stop := errors.New("stop")
+	if err := s.Each(func(idec.MSG) error { return stop }); err != stop {
+		t.Errorf("Each error is lost: %v", err)
+	}
+}
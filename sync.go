@@ -0,0 +1,207 @@
+package idec
+
+// Incremental echoes synchronisation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultSyncWindow index tail size requested from nodes without x/c
+const DefaultSyncWindow = 50
+
+// EchoState last synchronised echo state
+type EchoState struct {
+	Count  int    `json:"count"`
+	LastID string `json:"last_id"`
+}
+
+// SyncState echo states by node and echo name
+type SyncState map[string]map[string]EchoState
+
+// Syncer fetches only messages missing since the previous run.
+// State can be saved as JSON between runs.
+type Syncer struct {
+	State SyncState
+	// Window index tail size requested from nodes without x/c
+	Window int
+
+	mu sync.Mutex
+}
+
+// NewSyncer makes Syncer from saved state. state may be nil.
+func NewSyncer(state SyncState) *Syncer {
+	if state == nil {
+		state = make(SyncState)
+	}
+	return &Syncer{
+		State:  state,
+		Window: DefaultSyncWindow,
+	}
+}
+
+// nodeKey normalizes node address
+func nodeKey(node string) string {
+	return strings.TrimRight(node, "/")
+}
+
+// get echo state
+func (s *Syncer) get(node, echo string) (EchoState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.State[nodeKey(node)][echo]
+	return st, ok
+}
+
+// set echo state
+func (s *Syncer) set(node, echo string, st EchoState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.State == nil {
+		s.State = make(SyncState)
+	}
+	key := nodeKey(node)
+	if s.State[key] == nil {
+		s.State[key] = make(map[string]EchoState)
+	}
+	s.State[key][echo] = st
+}
+
+// Sync fetches new messages of echoes from node and updates state.
+// Echo state is updated only when all its messages are fetched,
+// messages of partially fetched echo are returned with error.
+// Unparsable messages are returned as errors and echo state stops
+// before them, so they and the next ones are fetched again next time.
+func (s *Syncer) Sync(ctx context.Context, c *Client, echoes []string) ([]Message, error) {
+	// Nodes without x/features, e.g. old ii ones, use window method
+	var counts map[string]int
+	if ok, err := c.supports(ctx, FeatureXCount); err == nil && ok {
+		counts, err = c.GetEchoCounts(ctx, echoes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var messages []Message
+	var errs []error
+	for _, echo := range echoes {
+		ids, next, err := s.missing(ctx, c, echo, counts)
+		if err != nil {
+			return messages, err
+		}
+
+		if len(ids) > 0 {
+			raw, fetchErr := NewBatchFetcher(c).GetRawMessages(ctx, ids)
+			failed := -1
+			for _, r := range raw {
+				m, err := ParseMessage(r.Message)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("message %s: %w", r.ID, err))
+					if failed < 0 {
+						failed = indexOf(ids, r.ID)
+					}
+					continue
+				}
+				m.ID = r.ID
+				messages = append(messages, m)
+			}
+			if fetchErr != nil {
+				return messages, errors.Join(append(errs, fetchErr)...)
+			}
+			// Raw messages are in ids order
+			switch {
+			case failed == 0:
+				continue
+			case failed > 0:
+				next = EchoState{next.Count - len(ids) + failed, ids[failed-1].MsgID}
+			}
+		}
+
+		s.set(c.Node, echo, next)
+	}
+
+	return messages, errors.Join(errs...)
+}
+
+// missing finds ids of echo missing since last sync
+func (s *Syncer) missing(ctx context.Context, c *Client, echo string, counts map[string]int) ([]ID, EchoState, error) {
+	st, ok := s.get(c.Node, echo)
+	if !ok || st.LastID == "" {
+		return s.full(ctx, c, echo, st)
+	}
+
+	if counts != nil {
+		remote, ok := counts[echo]
+		switch {
+		case !ok || remote < st.Count:
+			return s.full(ctx, c, echo, st)
+		case remote == st.Count:
+			return nil, st, nil
+		}
+
+		// Request missing tail with last known message
+		n := remote - st.Count + 1
+		tail, err := c.echoIndex(ctx, []string{echo}, sliceString(-n, n))
+		if err != nil {
+			return nil, st, err
+		}
+		if len(tail) != n || tail[0].MsgID != st.LastID {
+			return s.full(ctx, c, echo, st)
+		}
+		return tail[1:], EchoState{remote, tail[n-1].MsgID}, nil
+	}
+
+	window := s.Window
+	if window <= 0 {
+		window = DefaultSyncWindow
+	}
+	tail, err := c.echoIndex(ctx, []string{echo}, sliceString(-window, window))
+	if err != nil {
+		return nil, st, err
+	}
+	i := indexOf(tail, st.LastID)
+	if i < 0 {
+		return s.full(ctx, c, echo, st)
+	}
+	ids := tail[i+1:]
+	if len(ids) == 0 {
+		return nil, st, nil
+	}
+	return ids, EchoState{st.Count + len(ids), ids[len(ids)-1].MsgID}, nil
+}
+
+// full finds missing ids using full echo index
+func (s *Syncer) full(ctx context.Context, c *Client, echo string, st EchoState) ([]ID, EchoState, error) {
+	all, err := c.echoIndex(ctx, []string{echo}, "")
+	if err != nil {
+		return nil, st, err
+	}
+	if len(all) == 0 {
+		return nil, EchoState{}, nil
+	}
+
+	next := EchoState{len(all), all[len(all)-1].MsgID}
+	if i := indexOf(all, st.LastID); st.LastID != "" && i >= 0 {
+		return all[i+1:], next, nil
+	}
+	return all, next, nil
+}
+
+// indexOf finds message id position in ids
+func indexOf(ids []ID, msgid string) int {
+	for i, id := range ids {
+		if id.MsgID == msgid {
+			return i
+		}
+	}
+	return -1
+}
+
+// sliceString makes u/e offset:limit slice
+func sliceString(offset, limit int) string {
+	return strconv.Itoa(offset) + ":" + strconv.Itoa(limit)
+}
@@ -0,0 +1,150 @@
+package idec
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+// testBundle makes base64 bundled message with subject
+func testBundle(echo, subg string) string {
+	raw := strings.Join([]string{"ii/ok", echo, "1551689766", "Difrex", "dynamic,1", "All", subg, "", "Body"}, "\n")
+	return base64.StdEncoding.EncodeToString([]byte(raw))
+}
+
+func TestSyncerXCount(t *testing.T) {
+	c, mock := newMockClient()
+	mock.RegisterResponder("GET", "http://localhost/idec/x/features", httpmock.NewStringResponder(200, "u/e\nx/c\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/x/c/ii.test.14", httpmock.NewStringResponder(200, "ii.test.14:2\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/e/ii.test.14", httpmock.NewStringResponder(200, "ii.test.14\nhXzRNEzmMuzKkT1HCxUb\nJN3ylpxjaNofxgPy6NhL\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/hXzRNEzmMuzKkT1HCxUb/JN3ylpxjaNofxgPy6NhL", httpmock.NewStringResponder(200,
+		"hXzRNEzmMuzKkT1HCxUb:"+testBundle("ii.test.14", "first")+"\nJN3ylpxjaNofxgPy6NhL:"+testBundle("ii.test.14", "second")+"\n"))
+
+	s := NewSyncer(nil)
+
+	// First run: full index
+	msgs, err := s.Sync(context.Background(), c, []string{"ii.test.14"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Subg != "first" || msgs[1].ID != "JN3ylpxjaNofxgPy6NhL" {
+		t.Fatalf("Wrong messages: %+v", msgs)
+	}
+	st := s.State["http://localhost/idec"]["ii.test.14"]
+	if st.Count != 2 || st.LastID != "JN3ylpxjaNofxgPy6NhL" {
+		t.Errorf("Wrong state: %+v", st)
+	}
+
+	// Nothing new
+	msgs, err = s.Sync(context.Background(), c, []string{"ii.test.14"})
+	if err != nil || len(msgs) != 0 {
+		t.Errorf("Unexpected messages: %v, %v", msgs, err)
+	}
+
+	// One new message: only tail is requested
+	mock.RegisterResponder("GET", "http://localhost/idec/x/c/ii.test.14", httpmock.NewStringResponder(200, "ii.test.14:3\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/e/ii.test.14/-2:2", httpmock.NewStringResponder(200, "ii.test.14\nJN3ylpxjaNofxgPy6NhL\nxF3kkmrZYld330BO7qaA\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/xF3kkmrZYld330BO7qaA", httpmock.NewStringResponder(200, "xF3kkmrZYld330BO7qaA:"+testBundle("ii.test.14", "third")+"\n"))
+	full := mock.GetCallCountInfo()["GET http://localhost/idec/u/e/ii.test.14"]
+	msgs, err = s.Sync(context.Background(), c, []string{"ii.test.14"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Subg != "third" {
+		t.Fatalf("Wrong messages: %+v", msgs)
+	}
+	if mock.GetCallCountInfo()["GET http://localhost/idec/u/e/ii.test.14"] != full {
+		t.Error("Full index requested")
+	}
+
+	// Inconsistent tail: fall back to full index
+	mock.RegisterResponder("GET", "http://localhost/idec/x/c/ii.test.14", httpmock.NewStringResponder(200, "ii.test.14:4\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/e/ii.test.14/-2:2", httpmock.NewStringResponder(200, "ii.test.14\n3uS3uij0Y4AUnSxhf4WB\nzi9YpQGddLW5WQKi9GMf\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/e/ii.test.14", httpmock.NewStringResponder(200,
+		"ii.test.14\nhXzRNEzmMuzKkT1HCxUb\nxF3kkmrZYld330BO7qaA\n3uS3uij0Y4AUnSxhf4WB\nzi9YpQGddLW5WQKi9GMf\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/3uS3uij0Y4AUnSxhf4WB/zi9YpQGddLW5WQKi9GMf", httpmock.NewStringResponder(200,
+		"3uS3uij0Y4AUnSxhf4WB:"+testBundle("ii.test.14", "fourth")+"\nzi9YpQGddLW5WQKi9GMf:"+testBundle("ii.test.14", "fifth")+"\n"))
+	msgs, err = s.Sync(context.Background(), c, []string{"ii.test.14"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[1].Subg != "fifth" {
+		t.Fatalf("Wrong messages: %+v", msgs)
+	}
+	st = s.State["http://localhost/idec"]["ii.test.14"]
+	if st.Count != 4 || st.LastID != "zi9YpQGddLW5WQKi9GMf" {
+		t.Errorf("Wrong state: %+v", st)
+	}
+}
+
+func TestSyncerWindow(t *testing.T) {
+	testSyncerWindow(t, httpmock.NewStringResponder(200, "u/e\n"))
+}
+
+// Old ii nodes have no x/features
+func TestSyncerNoFeatures(t *testing.T) {
+	testSyncerWindow(t, httpmock.NewStringResponder(404, "404 page not found"))
+}
+
+func testSyncerWindow(t *testing.T, features httpmock.Responder) {
+	c, mock := newMockClient()
+	mock.RegisterResponder("GET", "http://localhost/idec/x/features", features)
+	mock.RegisterResponder("GET", "http://localhost/idec/u/e/ii.test.14/-3:3", httpmock.NewStringResponder(200, "ii.test.14\nhXzRNEzmMuzKkT1HCxUb\nJN3ylpxjaNofxgPy6NhL\nxF3kkmrZYld330BO7qaA\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/xF3kkmrZYld330BO7qaA", httpmock.NewStringResponder(200, "xF3kkmrZYld330BO7qaA:"+testBundle("ii.test.14", "third")+"\n"))
+
+	s := NewSyncer(SyncState{"http://localhost/idec": {"ii.test.14": {2, "JN3ylpxjaNofxgPy6NhL"}}})
+	s.Window = 3
+	msgs, err := s.Sync(context.Background(), c, []string{"ii.test.14"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].ID != "xF3kkmrZYld330BO7qaA" {
+		t.Fatalf("Wrong messages: %+v", msgs)
+	}
+	st := s.State["http://localhost/idec"]["ii.test.14"]
+	if st.Count != 3 || st.LastID != "xF3kkmrZYld330BO7qaA" {
+		t.Errorf("Wrong state: %+v", st)
+	}
+}
+
+// Unparsable messages are fetched again on the next sync
+func TestSyncerUnparsable(t *testing.T) {
+	c, mock := newMockClient()
+	mock.RegisterResponder("GET", "http://localhost/idec/x/features", httpmock.NewStringResponder(200, "u/e\nx/c\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/x/c/ii.test.14", httpmock.NewStringResponder(200, "ii.test.14:3\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/e/ii.test.14", httpmock.NewStringResponder(200, "ii.test.14\nhXzRNEzmMuzKkT1HCxUb\nJN3ylpxjaNofxgPy6NhL\nxF3kkmrZYld330BO7qaA\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/hXzRNEzmMuzKkT1HCxUb/JN3ylpxjaNofxgPy6NhL/xF3kkmrZYld330BO7qaA", httpmock.NewStringResponder(200,
+		"hXzRNEzmMuzKkT1HCxUb:"+testBundle("ii.test.14", "first")+"\nJN3ylpxjaNofxgPy6NhL:YmFk\nxF3kkmrZYld330BO7qaA:"+testBundle("ii.test.14", "third")+"\n"))
+
+	s := NewSyncer(nil)
+	msgs, err := s.Sync(context.Background(), c, []string{"ii.test.14"})
+	if !errors.Is(err, ErrTooFewLines) || !strings.Contains(err.Error(), "JN3ylpxjaNofxgPy6NhL") {
+		t.Errorf("Unparsable message is not reported: %v", err)
+	}
+	if len(msgs) != 2 || msgs[1].Subg != "third" {
+		t.Fatalf("Wrong messages: %+v", msgs)
+	}
+	st := s.State["http://localhost/idec"]["ii.test.14"]
+	if st.Count != 1 || st.LastID != "hXzRNEzmMuzKkT1HCxUb" {
+		t.Errorf("State is advanced past unparsable message: %+v", st)
+	}
+
+	mock.RegisterResponder("GET", "http://localhost/idec/u/e/ii.test.14/-3:3", httpmock.NewStringResponder(200, "ii.test.14\nhXzRNEzmMuzKkT1HCxUb\nJN3ylpxjaNofxgPy6NhL\nxF3kkmrZYld330BO7qaA\n"))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/JN3ylpxjaNofxgPy6NhL/xF3kkmrZYld330BO7qaA", httpmock.NewStringResponder(200,
+		"JN3ylpxjaNofxgPy6NhL:"+testBundle("ii.test.14", "second")+"\nxF3kkmrZYld330BO7qaA:"+testBundle("ii.test.14", "third")+"\n"))
+	msgs, err = s.Sync(context.Background(), c, []string{"ii.test.14"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].Subg != "second" {
+		t.Fatalf("Wrong messages: %+v", msgs)
+	}
+	st = s.State["http://localhost/idec"]["ii.test.14"]
+	if st.Count != 3 || st.LastID != "xF3kkmrZYld330BO7qaA" {
+		t.Errorf("Wrong state: %+v", st)
+	}
+}
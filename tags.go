@@ -0,0 +1,110 @@
+package idec
+
+// Message tags
+
+import (
+	"strings"
+)
+
+// Known tag keys
+const (
+	tagII    = "ii"
+	tagRepto = "repto"
+)
+
+// Tag message tag key/value pair
+type Tag struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Tags IDEC message tags in the original order,
+// so collected tags reproduce the parsed tagstring
+type Tags []Tag
+
+// NewTags makes ii/ok tags with optional repto
+func NewTags(ii, repto string) Tags {
+	t := Tags{{tagII, ii}}
+	t.Set(tagRepto, repto)
+	return t
+}
+
+// ParseTags parse message tags ii/ok/repto/MSGID/key/value
+func ParseTags(tags string) (Tags, error) {
+	var t Tags
+
+	// Value-less trailing key is dropped
+	for rest := tags; ; {
+		key, value, ok := strings.Cut(rest, "/")
+		if !ok {
+			break
+		}
+		value, rest, ok = strings.Cut(value, "/")
+		t = append(t, Tag{key, value})
+		if !ok {
+			break
+		}
+	}
+
+	if _, ok := t.Get(tagII); !ok {
+		return nil, ErrBadTags
+	}
+	return t, nil
+}
+
+// II returns ii tag value
+func (t Tags) II() string {
+	v, _ := t.Get(tagII)
+	return v
+}
+
+// Repto returns repto tag value
+func (t Tags) Repto() string {
+	v, _ := t.Get(tagRepto)
+	return v
+}
+
+// Get returns the first tag value of key
+func (t Tags) Get(key string) (string, bool) {
+	for _, tag := range t {
+		if tag.Key == key {
+			return tag.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set sets the first tag value of key in place,
+// new tags are added to the end. Empty value deletes tags of key.
+func (t *Tags) Set(key, value string) {
+	if value == "" {
+		var kept Tags
+		for _, tag := range *t {
+			if tag.Key != key {
+				kept = append(kept, tag)
+			}
+		}
+		*t = kept
+		return
+	}
+
+	for i := range *t {
+		if (*t)[i].Key == key {
+			(*t)[i].Value = value
+			return
+		}
+	}
+	*t = append(*t, Tag{key, value})
+}
+
+// CollectTags make ii/ok message tagstring
+func (t Tags) CollectTags() (string, error) {
+	if t.II() == "" {
+		return "", ErrBadTags
+	}
+	var s []string
+	for _, tag := range t {
+		s = append(s, tag.Key, tag.Value)
+	}
+	return strings.Join(s, "/"), nil
+}
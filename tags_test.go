@@ -0,0 +1,144 @@
+package idec
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTagsRoundTrip(t *testing.T) {
+	tests := []string{
+		"ii/ok",
+		"ii/ok/repto/hXzRNEzmMuzKkT1HCxUb",
+		"repto/hXzRNEzmMuzKkT1HCxUb/ii/ok",
+		"ii/ok/client/jii/repto/hXzRNEzmMuzKkT1HCxUb",
+		"sign/abc/ii/ok/sign/def",
+		"ii/ok/ii/dup",
+	}
+	for _, test := range tests {
+		tags, err := ParseTags(test)
+		if err != nil {
+			t.Errorf("%s: %v", test, err)
+			continue
+		}
+		collected, err := tags.CollectTags()
+		if err != nil {
+			t.Errorf("%s: %v", test, err)
+		}
+		if collected != test {
+			t.Errorf("Wrong tags collection: %s, want %s", collected, test)
+		}
+	}
+}
+
+// Tags order survives JSON, so message id does too
+func TestTagsJSON(t *testing.T) {
+	m := Message{
+		Echo:      "ii.test.14",
+		Timestamp: 1551689766,
+		From:      "Difrex",
+		Address:   "dynamic,1",
+		To:        "All",
+		Subg:      "test",
+		Body:      "\ntest",
+	}
+	var err error
+	m.Tags, err = ParseTags("ii/ok/x/1/repto/hXzRNEzmMuzKkT1HCxUb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := m.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Message
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	decodedRaw, err := decoded.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if MakeMsgID(decodedRaw) != MakeMsgID(raw) {
+		t.Errorf("Tags order is lost: %s", strings.SplitN(decodedRaw, "\n", 2)[0])
+	}
+}
+
+func TestParseTagsExtra(t *testing.T) {
+	tags, err := ParseTags("ii/ok/client/jii/repto/hXzRNEzmMuzKkT1HCxUb/dangling")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags.II() != "ok" || tags.Repto() != "hXzRNEzmMuzKkT1HCxUb" {
+		t.Errorf("Wrong known tags: %+v", tags)
+	}
+	if v, ok := tags.Get("client"); !ok || v != "jii" {
+		t.Errorf("Wrong client tag: %q %v", v, ok)
+	}
+	if _, ok := tags.Get("dangling"); ok {
+		t.Error("Value-less tag is parsed")
+	}
+
+	tags.Set("client", "go-idec")
+	tags.Set("new", "tag")
+	tags.Set("repto", "")
+	collected, _ := tags.CollectTags()
+	if collected != "ii/ok/client/go-idec/new/tag" {
+		t.Errorf("Wrong tags collection: %s", collected)
+	}
+
+	_, err = ParseTags("repto/hXzRNEzmMuzKkT1HCxUb")
+	if !errors.Is(err, ErrBadTags) {
+		t.Errorf("Tags without ii: %v", err)
+	}
+}
+
+func TestMessageRepto(t *testing.T) {
+	m := Message{
+		Tags:      NewTags("ok", ""),
+		Echo:      "ii.test.14",
+		Timestamp: 1,
+		From:      "name",
+		Address:   "node,1",
+		To:        "All",
+		Subg:      "test",
+		Body:      "\ntest",
+	}
+	m.SetRepto("hXzRNEzmMuzKkT1HCxUb")
+	if m.Repto() != "hXzRNEzmMuzKkT1HCxUb" || m.Tags.Repto() != m.Repto() {
+		t.Errorf("Wrong repto: %+v", m)
+	}
+
+	// Repto is rendered as tag
+	raw, err := m.Raw()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(raw, "ii/ok/repto/hXzRNEzmMuzKkT1HCxUb\n") {
+		t.Errorf("Wrong raw message: %s", raw)
+	}
+	parsed, err := ParseMessage(base64.StdEncoding.EncodeToString([]byte(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Repto() != m.Repto() {
+		t.Errorf("Wrong parsed repto: %+v", parsed)
+	}
+
+	// SetRepto doesn't change tags of message copies
+	reply := parsed
+	reply.SetRepto("")
+	if reply.Repto() != "" || parsed.Repto() != m.Repto() {
+		t.Errorf("Wrong repto removal: %+v %+v", reply, parsed)
+	}
+	if err := reply.Validate(); err != nil {
+		t.Error(err)
+	}
+}
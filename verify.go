@@ -0,0 +1,47 @@
+package idec
+
+// Fetched message ids verification
+
+import (
+	"fmt"
+)
+
+// VerifyPolicy what to do with messages not matching their ids
+type VerifyPolicy int
+
+// Verify policies
+const (
+	// VerifyAccept does not check message ids
+	VerifyAccept VerifyPolicy = iota
+	// VerifyWarn reports mismatches to Client.Warn and keeps messages
+	VerifyWarn
+	// VerifyReject drops mismatching messages
+	VerifyReject
+)
+
+// IDMismatchError message content does not hash to its id
+type IDMismatchError struct {
+	ID       string
+	Computed string
+}
+
+func (e *IDMismatchError) Error() string {
+	return fmt.Sprintf("message %s hashes to %s", e.ID, e.Computed)
+}
+
+func (e *IDMismatchError) Unwrap() error {
+	return ErrIDMismatch
+}
+
+// VerifyMSG re-derives message id from its content.
+// Returns *IDMismatchError if it differs from m.ID.
+func VerifyMSG(m MSG) error {
+	plain, _, err := DecodeBase64(m.Message)
+	if err != nil {
+		return fmt.Errorf("message %s: %w", m.ID, err)
+	}
+	if id := MakeMsgID(string(plain)); id != m.ID {
+		return &IDMismatchError{m.ID, id}
+	}
+	return nil
+}
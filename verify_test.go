@@ -0,0 +1,92 @@
+package idec
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"os"
+	"testing"
+
+	"gopkg.in/jarcoal/httpmock.v1"
+)
+
+// testRaw is message from TestMakeMsgID
+const testRaw = `ii/ok/repto/tU7J0bzuL2r4DosDkNPO
+pipe.2032
+1551689766
+Difrex
+dynamic,1
+Difrex
+Re: idec
+
+Или даже так:
+====
+curl -XPOST -H "X-Idec-Pauth: sdlkdsfjklsdf" -T /etc/passwd idec.node/x/d/msgid
+====
+`
+
+func TestVerifyMSG(t *testing.T) {
+	m := MSG{base64.StdEncoding.EncodeToString([]byte(testRaw)), "Jc0StQZltt2EoHV9fLee"}
+	if err := VerifyMSG(m); err != nil {
+		t.Error(err)
+	}
+
+	m.ID = "hXzRNEzmMuzKkT1HCxUb"
+	var mismatch *IDMismatchError
+	err := VerifyMSG(m)
+	if !errors.As(err, &mismatch) || mismatch.Computed != "Jc0StQZltt2EoHV9fLee" || !errors.Is(err, ErrIDMismatch) {
+		t.Errorf("Wrong mismatch error: %v", err)
+	}
+
+	if err := VerifyMSG(MSG{"BlaBlaBla", "hXzRNEzmMuzKkT1HCxUb"}); !errors.Is(err, ErrBadBase64) {
+		t.Error("Bad base64 verified")
+	}
+}
+
+func TestClientVerify(t *testing.T) {
+	c, mock := newMockClient()
+	good := base64.StdEncoding.EncodeToString([]byte(testRaw))
+	mock.RegisterResponder("GET", "http://localhost/idec/u/m/Jc0StQZltt2EoHV9fLee/hXzRNEzmMuzKkT1HCxUb", httpmock.NewStringResponder(200,
+		"Jc0StQZltt2EoHV9fLee:"+good+"\nhXzRNEzmMuzKkT1HCxUb:"+good+"\n"))
+	ids := []ID{{"pipe.2032", "Jc0StQZltt2EoHV9fLee"}, {"pipe.2032", "hXzRNEzmMuzKkT1HCxUb"}}
+
+	// Accept
+	msgs, err := c.GetRawMessages(context.Background(), ids)
+	if err != nil || len(msgs) != 2 {
+		t.Errorf("Wrong accept policy: %v, %v", msgs, err)
+	}
+
+	// Warn
+	var warnings []error
+	c.Verify = VerifyWarn
+	c.Warn = func(err error) {
+		warnings = append(warnings, err)
+	}
+	msgs, err = c.GetRawMessages(context.Background(), ids)
+	if err != nil || len(msgs) != 2 || len(warnings) != 1 {
+		t.Errorf("Wrong warn policy: %v, %v, %v", msgs, err, warnings)
+	}
+
+	// Warn without callback doesn't use global logger
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	c.Warn = nil
+	msgs, err = c.GetRawMessages(context.Background(), ids)
+	if err != nil || len(msgs) != 2 || logged.Len() != 0 {
+		t.Errorf("Wrong warn policy: %v, %v, %q", msgs, err, logged.String())
+	}
+
+	// Reject
+	c.Verify = VerifyReject
+	msgs, err = c.GetRawMessages(context.Background(), ids)
+	var mismatch *IDMismatchError
+	if !errors.As(err, &mismatch) || mismatch.ID != "hXzRNEzmMuzKkT1HCxUb" {
+		t.Errorf("Wrong reject error: %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].ID != "Jc0StQZltt2EoHV9fLee" {
+		t.Errorf("Wrong reject policy: %v", msgs)
+	}
+}